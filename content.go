@@ -0,0 +1,203 @@
+package sax
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+type invalidAction int
+
+const (
+	invalidAccept invalidAction = iota
+	invalidError
+	invalidDrop
+	invalidReplace
+)
+
+type InvalidCharPolicy struct {
+	action  invalidAction
+	replace rune
+}
+
+var (
+	ErrorOnInvalid = InvalidCharPolicy{action: invalidError}
+	DropInvalid    = InvalidCharPolicy{action: invalidDrop}
+)
+
+func ReplaceInvalid(c rune) InvalidCharPolicy {
+	return InvalidCharPolicy{
+		action:  invalidReplace,
+		replace: c,
+	}
+}
+
+func (r *Reader) SetInvalidCharPolicy(policy InvalidCharPolicy) {
+	r.invalid = policy
+}
+
+func (r *Reader) writeValid(buf *bytes.Buffer, c rune) error {
+	if r.invalid.action == invalidAccept || isChar(c) {
+		r.writeChar(buf, c)
+		return nil
+	}
+	switch r.invalid.action {
+	case invalidDrop:
+		return r.emitWarning(fmt.Sprintf("invalid character %U dropped", c))
+	case invalidReplace:
+		buf.WriteRune(r.invalid.replace)
+		return r.emitWarning(fmt.Sprintf("invalid character %U replaced", c))
+	default:
+		return fmt.Errorf("%w: invalid character %U", ErrMalformed, c)
+	}
+}
+
+func isChar(c rune) bool {
+	switch {
+	case c == tab || c == nl || c == cr:
+		return true
+	case c >= 0x20 && c <= 0xD7FF:
+		return true
+	case c >= 0xE000 && c <= 0xFFFD:
+		return true
+	default:
+		return c >= 0x10000 && c <= 0x10FFFF
+	}
+}
+
+type TrimMode int
+
+const (
+	TrimAll TrimMode = iota
+	TrimNewlines
+	TrimNone
+)
+
+type mixedState struct {
+	name  Name
+	text  bool
+	child bool
+}
+
+func (r *Reader) SetRejectMixedContent(reject bool) {
+	r.rejectMixed = reject
+}
+
+func (r *Reader) checkMixed(n *Node) error {
+	z := len(r.mixed)
+	switch n.Type {
+	case BeginElement:
+		if z > 0 {
+			r.mixed[z-1].child = true
+		}
+		if !n.SelfClosing {
+			r.mixed = append(r.mixed, mixedState{name: n.Name})
+		}
+	case EndElement:
+		if z > 0 {
+			r.mixed = r.mixed[:z-1]
+		}
+		return nil
+	case Text, CData, Entity:
+		if z > 0 && strings.TrimSpace(n.Content) != "" {
+			r.mixed[z-1].text = true
+		}
+	default:
+		return nil
+	}
+	if z > 0 && r.mixed[z-1].text && r.mixed[z-1].child {
+		return fmt.Errorf("%w: mixed content not allowed in %s", ErrMalformed, r.mixed[z-1].name)
+	}
+	return nil
+}
+
+type PartType int
+
+const (
+	LiteralPart PartType = iota
+	EntityPart
+	CharRefPart
+)
+
+type ContentPart struct {
+	Type PartType
+	Text string
+	Name string
+	Rune rune
+}
+
+func appendLiteral(parts []ContentPart, str string) []ContentPart {
+	if str == "" {
+		return parts
+	}
+	return append(parts, ContentPart{Type: LiteralPart, Text: str})
+}
+
+func (r *Reader) SetXMLSpaceAware(aware bool) {
+	r.spaceAware = aware
+}
+
+func (r *Reader) trimMode() TrimMode {
+	if !r.spaceAware {
+		return r.trim
+	}
+	z := len(r.scopes)
+	if r.release {
+		z--
+	}
+	if z > 0 && r.scopes[z-1].preserve {
+		return TrimNone
+	}
+	return r.trim
+}
+
+func trimParts(parts []ContentPart, mode TrimMode) []ContentPart {
+	if len(parts) > 0 && parts[0].Type == LiteralPart {
+		parts[0].Text = trimLeft(parts[0].Text, mode)
+		if parts[0].Text == "" {
+			parts = parts[1:]
+		}
+	}
+	if z := len(parts); z > 0 && parts[z-1].Type == LiteralPart {
+		parts[z-1].Text = trimRight(parts[z-1].Text, mode)
+		if parts[z-1].Text == "" {
+			parts = parts[:z-1]
+		}
+	}
+	return parts
+}
+
+func (r *Reader) trimText(str string) string {
+	mode := r.trimMode()
+	return trimRight(trimLeft(str, mode), mode)
+}
+
+func trimLeft(str string, mode TrimMode) string {
+	switch mode {
+	case TrimNone:
+		return str
+	case TrimNewlines:
+		rest := strings.TrimLeftFunc(str, isBlank)
+		if strings.ContainsAny(str[:len(str)-len(rest)], "\r\n") {
+			return rest
+		}
+		return str
+	default:
+		return strings.TrimLeftFunc(str, isBlank)
+	}
+}
+
+func trimRight(str string, mode TrimMode) string {
+	switch mode {
+	case TrimNone:
+		return str
+	case TrimNewlines:
+		rest := strings.TrimRightFunc(str, isBlank)
+		if strings.ContainsAny(str[len(rest):], "\r\n") {
+			return rest
+		}
+		return str
+	default:
+		return strings.TrimRightFunc(str, isBlank)
+	}
+}
@@ -0,0 +1,199 @@
+package sax
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+const (
+	encUTF8    = "utf-8"
+	encUTF16LE = "utf-16le"
+	encUTF16BE = "utf-16be"
+)
+
+var boms = []struct {
+	Mark     []byte
+	Encoding string
+}{
+	{Mark: []byte{0xEF, 0xBB, 0xBF}, Encoding: encUTF8},
+	{Mark: []byte{0xFF, 0xFE}, Encoding: encUTF16LE},
+	{Mark: []byte{0xFE, 0xFF}, Encoding: encUTF16BE},
+}
+
+func (r *Reader) detectBOM() {
+	for _, b := range boms {
+		mark, _ := r.rs.Peek(len(b.Mark))
+		if !bytes.Equal(mark, b.Mark) {
+			continue
+		}
+		r.rs.Discard(len(mark))
+		r.offset += int64(len(mark))
+		r.bom = b.Encoding
+		switch b.Encoding {
+		case encUTF16LE:
+			r.seeker = nil
+			r.rs = newSource(decodeUTF16(r.rs, binary.LittleEndian), r.bufsize)
+		case encUTF16BE:
+			r.seeker = nil
+			r.rs = newSource(decodeUTF16(r.rs, binary.BigEndian), r.bufsize)
+		}
+		return
+	}
+}
+
+func (r *Reader) Encoding() string {
+	switch {
+	case r.bom != "":
+		return r.bom
+	case r.declared != "":
+		return r.declared
+	case r.charset == Latin1:
+		return "iso-8859-1"
+	case r.charset == Windows1252:
+		return "windows-1252"
+	default:
+		return encUTF8
+	}
+}
+
+func (r *Reader) checkDeclaration(n *Node) error {
+	for _, a := range n.Attrs {
+		if a.Name.Name != "encoding" {
+			continue
+		}
+		r.declared = strings.ToLower(a.Value)
+		if r.bom == "" || compatibleEncoding(r.bom, a.Value) {
+			continue
+		}
+		return r.emitWarning(fmt.Sprintf("%s: encoding mismatch: BOM says %s but declaration says %s", r.pos, r.bom, a.Value))
+	}
+	return nil
+}
+
+func compatibleEncoding(bom, declared string) bool {
+	declared = strings.ToLower(declared)
+	if declared == bom {
+		return true
+	}
+	return declared == "utf-16" && (bom == encUTF16LE || bom == encUTF16BE)
+}
+
+type utf16Reader struct {
+	inner io.Reader
+	order binary.ByteOrder
+	buf   []byte
+}
+
+func decodeUTF16(r io.Reader, order binary.ByteOrder) io.Reader {
+	return &utf16Reader{
+		inner: r,
+		order: order,
+	}
+}
+
+func (u *utf16Reader) Read(b []byte) (int, error) {
+	for len(u.buf) == 0 {
+		c, err := u.readUnit()
+		if err != nil {
+			return 0, err
+		}
+		if utf16.IsSurrogate(c) {
+			next, err := u.readUnit()
+			if err != nil {
+				return 0, err
+			}
+			c = utf16.DecodeRune(c, next)
+		}
+		var tmp [utf8.UTFMax]byte
+		n := utf8.EncodeRune(tmp[:], c)
+		u.buf = append(u.buf, tmp[:n]...)
+	}
+	n := copy(b, u.buf)
+	u.buf = u.buf[n:]
+	return n, nil
+}
+
+func (u *utf16Reader) readUnit() (rune, error) {
+	var unit [2]byte
+	if _, err := io.ReadFull(u.inner, unit[:]); err != nil {
+		return 0, err
+	}
+	return rune(u.order.Uint16(unit[:])), nil
+}
+
+type Charset int
+
+const (
+	UTF8 Charset = iota
+	Latin1
+	Windows1252
+)
+
+func WithCharset(cs Charset) Option {
+	return func(r *Reader) {
+		r.charset = cs
+	}
+}
+
+var cp1252 = [32]rune{
+	0x20AC, 0x0081, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021,
+	0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0x008D, 0x017D, 0x008F,
+	0x0090, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0x009D, 0x017E, 0x0178,
+}
+
+func decodeCharset(r io.Reader, cs Charset) io.Reader {
+	switch cs {
+	case Latin1:
+		return &byteReader{
+			inner: r,
+			decode: func(b byte) rune {
+				return rune(b)
+			},
+		}
+	case Windows1252:
+		return &byteReader{
+			inner: r,
+			decode: func(b byte) rune {
+				if b >= 0x80 && b <= 0x9F {
+					return cp1252[b-0x80]
+				}
+				return rune(b)
+			},
+		}
+	default:
+		return r
+	}
+}
+
+type byteReader struct {
+	inner  io.Reader
+	decode func(byte) rune
+	buf    []byte
+	tmp    []byte
+}
+
+func (b *byteReader) Read(p []byte) (int, error) {
+	if len(b.buf) == 0 {
+		if b.tmp == nil {
+			b.tmp = make([]byte, 4096)
+		}
+		n, err := b.inner.Read(b.tmp)
+		if n == 0 {
+			return 0, err
+		}
+		var char [utf8.UTFMax]byte
+		for _, c := range b.tmp[:n] {
+			z := utf8.EncodeRune(char[:], b.decode(c))
+			b.buf = append(b.buf, char[:z]...)
+		}
+	}
+	n := copy(p, b.buf)
+	b.buf = b.buf[n:]
+	return n, nil
+}
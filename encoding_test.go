@@ -0,0 +1,76 @@
+package sax
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+func encodeUTF16LE(str string) []byte {
+	var buf bytes.Buffer
+	buf.Write([]byte{0xFF, 0xFE})
+	binary.Write(&buf, binary.LittleEndian, utf16.Encode([]rune(str)))
+	return buf.Bytes()
+}
+
+func TestEncodingMismatch(t *testing.T) {
+	doc := encodeUTF16LE(`<?xml version="1.0" encoding="UTF-8"?><root>héllo</root>`)
+	r := New(bytes.NewReader(doc), nil)
+	var warnings []string
+	r.OnWarning(func(str string) error {
+		warnings = append(warnings, str)
+		return nil
+	})
+	nodes, err := readAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "encoding mismatch") {
+		t.Errorf("mismatch warning expected, got %q", warnings)
+	}
+	var text string
+	for _, n := range nodes {
+		if n.Type == Text {
+			text = n.Content
+		}
+	}
+	if text != "héllo" {
+		t.Errorf("text mismatched: want %q, got %q", "héllo", text)
+	}
+}
+
+func TestCharsetWindows1252(t *testing.T) {
+	doc := []byte("<r>it\x92s \x93quoted\x94 \x97 caf\xe9</r>")
+	tests := []struct {
+		Charset Charset
+		Want    string
+	}{
+		{Charset: Windows1252, Want: "it’s “quoted” — café"},
+		{Charset: Latin1, Want: "it\u0092s \u0093quoted\u0094 \u0097 café"},
+	}
+	for _, tt := range tests {
+		nodes, err := readAll(New(bytes.NewReader(doc), nil, WithCharset(tt.Charset)))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(nodes) != 3 || nodes[1].Content != tt.Want {
+			t.Errorf("charset %d: text mismatched: want %q, got %v", tt.Charset, tt.Want, nodes)
+		}
+	}
+}
+
+func TestEncodingFromBOM(t *testing.T) {
+	r := New(bytes.NewReader(encodeUTF16LE(`<root>héllo</root>`)), nil)
+	nodes, err := readAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(nodes) != 3 || nodes[1].Content != "héllo" {
+		t.Errorf("unexpected nodes: %v", nodes)
+	}
+	if got := r.Encoding(); got != "utf-16le" {
+		t.Errorf("encoding mismatched: want %q, got %q", "utf-16le", got)
+	}
+}
@@ -0,0 +1,65 @@
+package sax
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+)
+
+var escapes = func() map[rune]string {
+	set := make(map[rune]string)
+	for name, char := range entities {
+		set[char] = "&" + name + ";"
+	}
+	return set
+}()
+
+func EscapeText(s string) string {
+	return escapeString(s, func(c rune) bool {
+		return c == langle || c == rangle || c == ampersand
+	})
+}
+
+func EscapeAttr(s string, quote rune) string {
+	return escapeString(s, func(c rune) bool {
+		return c == langle || c == rangle || c == ampersand || c == quote
+	})
+}
+
+func escapeString(s string, accept func(rune) bool) string {
+	var str strings.Builder
+	str.Grow(len(s))
+	for _, c := range s {
+		if e, ok := escapes[c]; ok && accept(c) {
+			str.WriteString(e)
+			continue
+		}
+		str.WriteRune(c)
+	}
+	return str.String()
+}
+
+func DecodeEntities(s string) (string, error) {
+	var (
+		buf bytes.Buffer
+		rs  = New(strings.NewReader(s), nil, WithNoInitialSkip())
+	)
+	for {
+		c, err := rs.read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return "", err
+		}
+		if c == ampersand {
+			if _, err := rs.writeEntity(&buf); err != nil {
+				return "", err
+			}
+			continue
+		}
+		buf.WriteRune(c)
+	}
+	return buf.String(), nil
+}
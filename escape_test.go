@@ -0,0 +1,59 @@
+package sax
+
+import (
+	"testing"
+)
+
+func TestEscapeText(t *testing.T) {
+	const (
+		str  = `a < b > c & "d" 'e'`
+		want = `a &lt; b &gt; c &amp; "d" 'e'`
+	)
+	if got := EscapeText(str); got != want {
+		t.Errorf("escaped text mismatched: want %q, got %q", want, got)
+	}
+}
+
+func TestEscapeAttr(t *testing.T) {
+	const str = `a < b > c & "d" 'e'`
+	tests := []struct {
+		Quote rune
+		Want  string
+	}{
+		{Quote: '"', Want: `a &lt; b &gt; c &amp; &quot;d&quot; 'e'`},
+		{Quote: '\'', Want: `a &lt; b &gt; c &amp; "d" &apos;e&apos;`},
+	}
+	for _, tt := range tests {
+		if got := EscapeAttr(str, tt.Quote); got != tt.Want {
+			t.Errorf("escaped attribute (%c) mismatched: want %q, got %q", tt.Quote, tt.Want, got)
+		}
+	}
+}
+
+func TestDecodeEntities(t *testing.T) {
+	tests := []struct {
+		Input string
+		Want  string
+		Fail  bool
+	}{
+		{Input: "a &amp; b &#65;", Want: "a & b A"},
+		{Input: "  &lt;&#x21;&gt;  ", Want: "  <!>  "},
+		{Input: "a &unknown; b", Fail: true},
+	}
+	for _, tt := range tests {
+		got, err := DecodeEntities(tt.Input)
+		if tt.Fail {
+			if err == nil {
+				t.Errorf("%q: expected error", tt.Input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", tt.Input, err)
+			continue
+		}
+		if got != tt.Want {
+			t.Errorf("%q: decoded text mismatched: want %q, got %q", tt.Input, tt.Want, got)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package sax
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"strings"
+)
+
+func Extract(src io.Reader, pattern string, w io.Writer, root Name) error {
+	var (
+		rs = New(src, nil)
+		ws = NewWriter(w)
+	)
+	if err := ws.Write(&Node{Type: BeginElement, Name: root}); err != nil {
+		return err
+	}
+	for {
+		n, err := rs.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return err
+		}
+		if n.Type != BeginElement || !match(pattern, rs.pathOf(n)) {
+			continue
+		}
+		if err := rs.copySubtree(n, ws); err != nil {
+			return err
+		}
+	}
+	if err := ws.Write(&Node{Type: EndElement, Name: root}); err != nil {
+		return err
+	}
+	return ws.Flush()
+}
+
+func CountElements(rs io.Reader, name Name) (int, error) {
+	var (
+		rd    = New(rs, keepElements)
+		node  Node
+		count int
+	)
+	rd.SetLazyAttrs(true)
+	for {
+		err := rd.ReadInto(&node)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return count, err
+		}
+		if node.Type == BeginElement && node.Name.Equal(name) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func keepElements(t NodeType, _ Name) error {
+	if t == BeginElement {
+		return nil
+	}
+	return ErrSkip
+}
+
+func (r *Reader) copySubtree(n *Node, ws *Writer) error {
+	hoisted, err := r.hoistNamespaces(n)
+	if err != nil {
+		return err
+	}
+	root := *n
+	root.Attrs = append(hoisted, n.Attrs...)
+	if err := ws.Write(&root); err != nil || n.SelfClosing {
+		return err
+	}
+	depth := r.Depth()
+	for r.Depth() >= depth {
+		n, err := r.Read()
+		if err != nil {
+			return err
+		}
+		if err := ws.Write(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Reader) hoistNamespaces(n *Node) ([]Attr, error) {
+	var (
+		base  = len(r.scopes) - 1
+		used  = make(map[string]string)
+		depth = len(r.stack)
+	)
+	collect := func(n *Node) {
+		r.usePrefix(n.NS, base, used)
+		for _, a := range n.Attrs {
+			if a.NS != "" && !isNamespaceDecl(a.Name) {
+				r.usePrefix(a.NS, base, used)
+			}
+		}
+	}
+	collect(n)
+	if !n.SelfClosing {
+		err := r.scanAhead(func(n *Node) bool {
+			if n.Type == BeginElement {
+				collect(n)
+			}
+			return n.Type == EndElement && len(r.stack) < depth
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	attrs := make([]Attr, 0, len(used))
+	for prefix, uri := range used {
+		name := Name{NS: xmlns, Name: prefix}
+		if prefix == "" {
+			name = Name{Name: xmlns}
+		}
+		attrs = append(attrs, Attr{Name: name, Value: uri})
+	}
+	sort.Slice(attrs, func(i, j int) bool {
+		return attrs[i].Fqn() < attrs[j].Fqn()
+	})
+	return attrs, nil
+}
+
+func (r *Reader) usePrefix(prefix string, base int, used map[string]string) {
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		uri, ok := r.scopes[i].ns[prefix]
+		if !ok {
+			continue
+		}
+		if i < base && uri != "" {
+			used[prefix] = uri
+		}
+		return
+	}
+}
+
+func (r *Reader) pathOf(n *Node) []Name {
+	path := append([]Name{}, r.stack...)
+	if n.Type == BeginElement && n.SelfClosing {
+		path = append(path, n.Name)
+	}
+	return path
+}
+
+func match(pattern string, path []Name) bool {
+	if pattern == "" {
+		return false
+	}
+	var (
+		steps []string
+		desc  []bool
+		deep  = !strings.HasPrefix(pattern, "/")
+	)
+	for _, s := range strings.Split(strings.TrimPrefix(pattern, "/"), "/") {
+		if s == "" {
+			deep = true
+			continue
+		}
+		steps = append(steps, s)
+		desc = append(desc, deep)
+		deep = false
+	}
+	return matchSteps(steps, desc, path)
+}
+
+func matchSteps(steps []string, desc []bool, path []Name) bool {
+	if len(steps) == 0 {
+		return len(path) == 0
+	}
+	for i := range path {
+		if i > 0 && !desc[0] {
+			break
+		}
+		if !matchStep(steps[0], path[i]) {
+			continue
+		}
+		if matchSteps(steps[1:], desc[1:], path[i+1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchStep(step string, n Name) bool {
+	return step == "*" || step == n.Fqn() || (step == n.LocalName() && !strings.Contains(step, ":"))
+}
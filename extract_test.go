@@ -0,0 +1,181 @@
+package sax
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestExtractInheritedNamespaces(t *testing.T) {
+	const doc = `<r xmlns="http://d" xmlns:p="urn:p"><items><item p:x="1"><name>a</name></item></items></r>`
+	var buf bytes.Buffer
+	if err := Extract(strings.NewReader(doc), "item", &buf, Name{Name: "out"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := `<out><item xmlns="http://d" xmlns:p="urn:p" p:x="1"><name>a</name></item></out>`
+	if got := buf.String(); got != want {
+		t.Errorf("namespaces not redeclared:\nwant %s\ngot  %s", want, got)
+	}
+}
+
+type eofReader struct {
+	io.Reader
+	done bool
+}
+
+func (r *eofReader) Read(b []byte) (int, error) {
+	n, err := r.Reader.Read(b)
+	if err == io.EOF {
+		r.done = true
+	}
+	return n, err
+}
+
+type earlyWriter struct {
+	src   *eofReader
+	early bool
+}
+
+func (w *earlyWriter) Write(b []byte) (int, error) {
+	if !w.src.done {
+		w.early = true
+	}
+	return len(b), nil
+}
+
+func TestExtractStreaming(t *testing.T) {
+	doc := "<r>" + strings.Repeat("<item>some text</item>", 1000) + "</r>"
+	var (
+		src = &eofReader{Reader: iotest.OneByteReader(strings.NewReader(doc))}
+		out = &earlyWriter{src: src}
+	)
+	if err := Extract(src, "item", out, Name{Name: "out"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !out.early {
+		t.Errorf("output buffered until the end of input")
+	}
+}
+
+const countDoc = `<records xmlns:x="urn:x">
+  <record id="1" x:kind="a"><name>one</name><record id="nested"/></record>
+  <record id="2"><![CDATA[<record/>]]></record>
+  <!-- <record/> -->
+  <x:record/>
+</records>`
+
+func TestCountElements(t *testing.T) {
+	var (
+		r    = New(strings.NewReader(countDoc), nil)
+		want int
+	)
+	r.OnBeginElement(func(n Name) error {
+		if n.Equal(Name{Name: "record"}) {
+			want++
+		}
+		return nil
+	})
+	if err := r.Run(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	got, err := CountElements(strings.NewReader(countDoc), Name{Name: "record"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got != want || got != 3 {
+		t.Errorf("want %d elements, got %d", want, got)
+	}
+}
+
+func countBenchDoc() string {
+	var str strings.Builder
+	str.WriteString("<records>")
+	for i := 0; i < 1000; i++ {
+		str.WriteString(`<record id="1" kind="a" lang="en"><name>some name</name></record>`)
+	}
+	str.WriteString("</records>")
+	return str.String()
+}
+
+func BenchmarkCountElements(b *testing.B) {
+	doc := countBenchDoc()
+	b.ReportAllocs()
+	b.SetBytes(int64(len(doc)))
+	for i := 0; i < b.N; i++ {
+		if _, err := CountElements(strings.NewReader(doc), Name{Name: "record"}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCountRun(b *testing.B) {
+	doc := countBenchDoc()
+	b.ReportAllocs()
+	b.SetBytes(int64(len(doc)))
+	for i := 0; i < b.N; i++ {
+		var (
+			r     = New(strings.NewReader(doc), nil)
+			count int
+		)
+		r.OnBeginElement(func(n Name) error {
+			if n.Name == "record" {
+				count++
+			}
+			return nil
+		})
+		if err := r.Run(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestExtractItems(t *testing.T) {
+	const doc = `<root><items><item id="1"/><item id="2"><sub>text</sub></item></items><other><item id="3"/></other></root>`
+	var buf bytes.Buffer
+	if err := Extract(strings.NewReader(doc), "//item", &buf, Name{Name: "items"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := `<items><item id="1"/><item id="2"><sub>text</sub></item><item id="3"/></items>`
+	if got := buf.String(); got != want {
+		t.Errorf("extracted document mismatched:\nwant %s\ngot  %s", want, got)
+	}
+}
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		Pattern string
+		Path    []Name
+		Want    bool
+	}{
+		{Pattern: "//item", Path: []Name{{Name: "root"}, {Name: "items"}}, Want: false},
+		{Pattern: "//item", Path: []Name{{Name: "root"}, {Name: "items"}, {Name: "item"}}, Want: true},
+		{Pattern: "/root/item", Path: []Name{{Name: "root"}, {Name: "items"}, {Name: "item"}}, Want: false},
+		{Pattern: "/root/*/item", Path: []Name{{Name: "root"}, {Name: "items"}, {Name: "item"}}, Want: true},
+	}
+	for _, tt := range tests {
+		if got := match(tt.Pattern, tt.Path); got != tt.Want {
+			t.Errorf("%s against %v: want %t, got %t", tt.Pattern, tt.Path, tt.Want, got)
+		}
+	}
+}
+
+func TestExtractHoistUsedPrefixes(t *testing.T) {
+	const doc = `<root xmlns:sax="http://localhost" xmlns:x="urn:x" xmlns:y="urn:y" xmlns="urn:d">` +
+		`<list><sax:item><sax:name y:lang="en">a</sax:name><z:sub xmlns:z="urn:z"/></sax:item></list>` +
+		`</root>`
+	want := `<out><sax:item xmlns:sax="http://localhost" xmlns:y="urn:y"><sax:name y:lang="en">a</sax:name><z:sub xmlns:z="urn:z"/></sax:item></out>`
+	for name, src := range map[string]io.Reader{
+		"seeker": strings.NewReader(doc),
+		"plain":  plainReader{strings.NewReader(doc)},
+	} {
+		var buf bytes.Buffer
+		if err := Extract(src, "sax:item", &buf, Name{Name: "out"}); err != nil {
+			t.Fatalf("%s: unexpected error: %s", name, err)
+		}
+		if got := buf.String(); got != want {
+			t.Errorf("%s: hoisted namespaces mismatched:\nwant %s\ngot  %s", name, want, got)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package sax
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io"
+)
+
+func Fingerprint(rs io.Reader) ([]byte, error) {
+	var (
+		sum = sha256.New()
+		ws  = NewWriter(sum)
+		rd  = New(rs, keepCanonical)
+	)
+	for {
+		n, err := rd.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		if err := writeCanonical(ws, n); err != nil {
+			return nil, err
+		}
+	}
+	if err := ws.Flush(); err != nil {
+		return nil, err
+	}
+	return sum.Sum(nil), nil
+}
+
+func keepCanonical(t NodeType, n Name) error {
+	switch {
+	case t == Comment || t == DocType || t == Declaration:
+		return ErrSkip
+	case t == ProcInst && n.Name == "xml":
+		return ErrSkip
+	default:
+		return nil
+	}
+}
+
+func writeCanonical(ws *Writer, n *Node) error {
+	switch n.Type {
+	case BeginElement:
+		c := *n
+		c.Attrs = n.SortedAttrs()
+		c.SelfClosing = false
+		if err := ws.Write(&c); err != nil || !n.SelfClosing {
+			return err
+		}
+		return ws.Write(&Node{Type: EndElement, Name: n.Name})
+	case Text, CData, Entity:
+		if n.Content == "" {
+			return nil
+		}
+		return ws.Write(&Node{Type: Text, Content: n.Content})
+	default:
+		return ws.Write(n)
+	}
+}
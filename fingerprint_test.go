@@ -0,0 +1,35 @@
+package sax
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	const (
+		compact  = `<?xml version="1.0"?><r a="1" b="2"><item>text</item><empty/></r>`
+		indented = `<?xml version="1.0"?>
+<!-- formatted -->
+<r b="2"   a="1">
+  <item>
+    text
+  </item>
+  <empty></empty>
+</r>`
+		changed = `<r a="1" b="3"><item>text</item><empty/></r>`
+	)
+	sum := func(doc string) []byte {
+		b, err := Fingerprint(strings.NewReader(doc))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return b
+	}
+	if left, right := sum(compact), sum(indented); !bytes.Equal(left, right) {
+		t.Errorf("fingerprints of equal documents differ: %x != %x", left, right)
+	}
+	if left, right := sum(compact), sum(changed); bytes.Equal(left, right) {
+		t.Errorf("fingerprints of different documents are equal: %x", left)
+	}
+}
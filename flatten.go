@@ -0,0 +1,82 @@
+package sax
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type flatLevel struct {
+	path   string
+	counts map[string]int
+}
+
+func Flatten(rs io.Reader) (map[string]string, error) {
+	var (
+		rd    = New(rs, nil)
+		set   = make(map[string]string)
+		stack = []flatLevel{{counts: make(map[string]int)}}
+	)
+	rd.SetPreserveCData(false)
+	for {
+		n, err := rd.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		top := &stack[len(stack)-1]
+		switch n.Type {
+		case BeginElement:
+			name := n.Name.Fqn()
+			top.counts[name]++
+			var (
+				count = top.counts[name]
+				path  = joinPath(top.path, name)
+			)
+			if count == 2 {
+				renameKeys(set, path, path+"[0]")
+			}
+			if count > 1 {
+				path = fmt.Sprintf("%s[%d]", path, count-1)
+			}
+			for _, a := range n.Attrs {
+				set[joinPath(path, "@"+a.Fqn())] = a.Value
+			}
+			if !n.SelfClosing {
+				stack = append(stack, flatLevel{path: path, counts: make(map[string]int)})
+			}
+		case EndElement:
+			stack = stack[:len(stack)-1]
+		case Text, CData:
+			if n.Content == "" || top.path == "" {
+				break
+			}
+			if str, ok := set[top.path]; ok {
+				set[top.path] = str + " " + n.Content
+			} else {
+				set[top.path] = n.Content
+			}
+		}
+	}
+	return set, nil
+}
+
+func joinPath(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "/" + name
+}
+
+func renameKeys(set map[string]string, from, to string) {
+	for key, value := range set {
+		if key != from && !strings.HasPrefix(key, from+"/") {
+			continue
+		}
+		delete(set, key)
+		set[to+strings.TrimPrefix(key, from)] = value
+	}
+}
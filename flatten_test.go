@@ -0,0 +1,48 @@
+package sax
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFlattenSample(t *testing.T) {
+	got, err := Flatten(strings.NewReader(sample))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := map[string]string{
+		"root/@xmlns:sax":                                "http://localhost",
+		"root/sax:DocumentElement/@sax:param":            "value",
+		"root/sax:DocumentElement/First-Element":         "! Some Text",
+		"root/sax:DocumentElement/SecondElement/@param2": "something",
+		"root/sax:DocumentElement/SecondElement":         "Pre-Text Post-text.",
+		"root/sax:DocumentElement/SecondElement/Inline":  "Inlined text",
+		"root/sax:DocumentElement/script":                "<message>Welcome</message>",
+	}
+	compareFlat(t, want, got)
+}
+
+func TestFlattenRepeated(t *testing.T) {
+	const doc = `<root><items><item><name>Jane</name></item><item><name>John</name></item></items><other/></root>`
+	got, err := Flatten(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := map[string]string{
+		"root/items/item[0]/name": "Jane",
+		"root/items/item[1]/name": "John",
+	}
+	compareFlat(t, want, got)
+}
+
+func compareFlat(t *testing.T, want, got map[string]string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("want %d keys, got %d: %q", len(want), len(got), got)
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s: want %q, got %q", key, value, got[key])
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package sax
+
+import (
+	"context"
+	"time"
+)
+
+const followDelay = 100 * time.Millisecond
+
+func (r *Reader) SetFollow(follow bool) {
+	r.follow = follow
+}
+
+func (r *Reader) SetContext(ctx context.Context) {
+	r.ctx = ctx
+}
+
+func (r *Reader) resume() error {
+	if !r.follow && !r.incremental {
+		return nil
+	}
+	for {
+		c, err := r.read()
+		if err != nil {
+			return err
+		}
+		if !isBlank(c) || r.trimMode() != TrimAll {
+			return r.unread()
+		}
+		if r.layout {
+			r.blanks.WriteRune(c)
+		}
+	}
+}
+
+func (r *Reader) wait() error {
+	ctx := r.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(followDelay):
+		return nil
+	}
+}
@@ -0,0 +1,110 @@
+package sax
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFollowLastRecord(t *testing.T) {
+	r := New(strings.NewReader("<root><rec>1</rec>\n"), nil)
+	r.SetFollow(true)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r.SetContext(ctx)
+
+	nodes := make(chan *Node)
+	go func() {
+		defer close(nodes)
+		for {
+			n, err := r.Read()
+			if err != nil {
+				return
+			}
+			nodes <- n
+		}
+	}()
+	want := []NodeType{BeginElement, BeginElement, Text, EndElement}
+	for i, typ := range want {
+		select {
+		case n := <-nodes:
+			if n.Type != typ {
+				t.Fatalf("node %d: want %s, got %s", i, typ, n.Type)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("node %d (%s) held back while following", i, typ)
+		}
+	}
+}
+
+func TestFollowAppendedRecord(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "records.xml")
+	if err := os.WriteFile(file, []byte("<root><rec>1</rec>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	r := New(f, nil)
+	r.SetFollow(true)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	r.SetContext(ctx)
+
+	for i := 0; i < 4; i++ {
+		if _, err := r.Read(); err != nil {
+			t.Fatalf("node %d: unexpected error: %s", i, err)
+		}
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		w, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return
+		}
+		defer w.Close()
+		w.WriteString("<rec>2</rec>")
+	}()
+	n, err := r.Find(func(n *Node) bool {
+		return n.Type == Text
+	})
+	if err != nil {
+		t.Fatalf("appended record not picked up: %s", err)
+	}
+	if n.Content != "2" {
+		t.Errorf("appended record mismatched: want %q, got %q", "2", n.Content)
+	}
+}
+
+func TestFollowStreamCancel(t *testing.T) {
+	r := New(strings.NewReader("<root><rec/>"), nil)
+	r.SetFollow(true)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	queue := r.Stream(ctx)
+	for i := 0; i < 2; i++ {
+		<-queue
+	}
+	cancel()
+	select {
+	case <-drain(queue):
+	case <-time.After(time.Second):
+		t.Fatal("stream still running after cancel")
+	}
+}
+
+func drain(queue <-chan Event) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range queue {
+		}
+	}()
+	return done
+}
@@ -0,0 +1,42 @@
+package sax
+
+func (r *Reader) SetPreserveLayout(preserve bool) {
+	r.layout = preserve
+	if !preserve {
+		r.blanks.Reset()
+	}
+}
+
+func (r *Reader) TrailingWhitespace() string {
+	return r.blanks.String()
+}
+
+func (r *Reader) startLayout() {
+	if !r.layout {
+		return
+	}
+	r.capturing = true
+	r.capture.Reset()
+}
+
+func (r *Reader) layoutNode(n *Node, err error) (*Node, error) {
+	raw, ok := r.stopCapture()
+	if !ok || err != nil || n == nil {
+		return n, err
+	}
+	if r.skipText(n) {
+		r.blanks.WriteString(raw)
+		return n, err
+	}
+	r.attachLayout(n, raw)
+	return n, err
+}
+
+func (r *Reader) attachLayout(n *Node, raw string) {
+	if !r.layout || n == nil {
+		return
+	}
+	n.Raw = raw
+	n.LeadingWhitespace = r.blanks.String()
+	r.blanks.Reset()
+}
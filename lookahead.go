@@ -0,0 +1,137 @@
+package sax
+
+import (
+	"fmt"
+	"io"
+)
+
+type childCounter struct {
+	level int
+	count int
+}
+
+func (c *childCounter) update(n *Node) bool {
+	switch n.Type {
+	case BeginElement:
+		if c.level == 0 {
+			c.count++
+		}
+		if !n.SelfClosing {
+			c.level++
+		}
+	case EndElement:
+		c.level--
+	}
+	return c.level < 0
+}
+
+func (r *Reader) CountChildren() (int, error) {
+	if r.Depth() == 0 {
+		return 0, fmt.Errorf("no element opened")
+	}
+	var counter childCounter
+	if n := r.peeked; n != nil && counter.update(n) {
+		return counter.count, nil
+	}
+	err := r.scanAhead(counter.update)
+	if err != nil {
+		return 0, err
+	}
+	return counter.count, nil
+}
+
+func (r *Reader) scanAhead(done func(*Node) bool) error {
+	m := r.bookmark()
+	if n := r.peeked; n != nil {
+		r.rewind(n)
+	}
+	var (
+		into    = r.into
+		restore = r.silent()
+		err     error
+	)
+	r.into = nil
+	for {
+		var n *Node
+		if n, err = r.next(); err != nil || done(n) {
+			break
+		}
+	}
+	restore()
+	r.into = into
+	if err := r.reset(m); err != nil {
+		return err
+	}
+	return err
+}
+
+type bookmark struct {
+	offset         int64
+	pos, prevPos   Position
+	last, prevLast rune
+	eol            string
+	pending        bool
+	event          Position
+	stack          []Name
+	scopes         []scope
+	queue          []*Node
+	release        bool
+	rooted         bool
+	report         Report
+	models         int
+	stylesheets    int
+	blanks         int
+}
+
+func (r *Reader) bookmark() bookmark {
+	m := bookmark{
+		offset:      r.offset,
+		pos:         r.pos,
+		prevPos:     r.prevPos,
+		last:        r.last,
+		prevLast:    r.prevLast,
+		eol:         r.eol,
+		pending:     r.pending,
+		event:       r.event,
+		stack:       append([]Name{}, r.stack...),
+		scopes:      append([]scope{}, r.scopes...),
+		queue:       append([]*Node{}, r.queue...),
+		release:     r.release,
+		rooted:      r.rooted,
+		report:      r.report,
+		models:      len(r.models),
+		stylesheets: len(r.stylesheets),
+		blanks:      r.blanks.Len(),
+	}
+	if r.seeker == nil {
+		r.marking = true
+		r.marked.Reset()
+	}
+	return m
+}
+
+func (r *Reader) reset(m bookmark) error {
+	r.pos, r.prevPos = m.pos, m.prevPos
+	r.last, r.prevLast = m.last, m.prevLast
+	r.eol, r.pending = m.eol, m.pending
+	r.event = m.event
+	r.stack, r.scopes, r.queue = m.stack, m.scopes, m.queue
+	r.release, r.rooted = m.release, m.rooted
+	r.report = m.report
+	r.models = r.models[:m.models]
+	r.stylesheets = r.stylesheets[:m.stylesheets]
+	r.blanks.Truncate(m.blanks)
+	r.capturing = false
+	if r.seeker != nil {
+		if _, err := r.seeker.Seek(m.offset, io.SeekStart); err != nil {
+			return err
+		}
+		r.offset = m.offset
+		r.rs = newSource(r.seeker, r.bufsize)
+		return nil
+	}
+	r.marking = false
+	r.offset = m.offset
+	r.rs = replay(r.rs, r.marked.Bytes())
+	return nil
+}
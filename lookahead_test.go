@@ -0,0 +1,77 @@
+package sax
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+const lookaheadDoc = `<root xmlns:p="urn:p">
+  <list>
+    <p:item a="1">one</p:item>
+    <item xmlns="urn:d"><sub/></item>
+    <!-- note -->
+    <item>three</item>
+  </list>
+</root>`
+
+func traceReader(r *Reader, count bool) (string, int, error) {
+	var (
+		events = recordEvents(r)
+		lines  []string
+		total  = -1
+	)
+	r.OnRawTag(func(str string) error {
+		*events = append(*events, "raw "+str)
+		return nil
+	})
+	for {
+		n, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", total, err
+		}
+		if count && n.Type == BeginElement && n.Name.Name == "list" {
+			if total, err = r.CountChildren(); err != nil {
+				return "", total, err
+			}
+		}
+		lines = append(lines, fmt.Sprintf("%s %s %s depth=%d", n.Type, n.Name, r.Locator().Position, r.Depth()))
+	}
+	return strings.Join(lines, "\n") + "\n" + strings.Join(*events, "\n"), total, nil
+}
+
+type plainReader struct {
+	io.Reader
+}
+
+func TestCountChildren(t *testing.T) {
+	want, _, err := traceReader(New(strings.NewReader(lookaheadDoc), nil), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	sources := map[string]func() io.Reader{
+		"seeker": func() io.Reader {
+			return strings.NewReader(lookaheadDoc)
+		},
+		"stream": func() io.Reader {
+			return plainReader{strings.NewReader(lookaheadDoc)}
+		},
+	}
+	for name, src := range sources {
+		got, total, err := traceReader(New(src(), nil), true)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", name, err)
+			continue
+		}
+		if total != 3 {
+			t.Errorf("%s: want 3 children, got %d", name, total)
+		}
+		if got != want {
+			t.Errorf("%s: events differ after lookahead\nwant:\n%s\ngot:\n%s", name, want, got)
+		}
+	}
+}
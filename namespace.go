@@ -0,0 +1,253 @@
+package sax
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/url"
+	"strings"
+)
+
+const (
+	xmlns    = "xmlns"
+	xmlURI   = "http://www.w3.org/XML/1998/namespace"
+	xmlnsURI = "http://www.w3.org/2000/xmlns/"
+)
+
+type AttrFilter func(owner, attr Name, uri string) bool
+
+type NamespaceMode int
+
+const (
+	NSPrefix NamespaceMode = iota
+	NSResolvedURI
+	NSCanonical
+)
+
+func isNamespaceDecl(n Name) bool {
+	return n.NS == xmlns || (n.NS == "" && n.Name == xmlns)
+}
+
+func namespacePrefix(n Name) string {
+	if n.NS == xmlns {
+		return n.Name
+	}
+	return ""
+}
+
+func duplicatedNamespace(n Name) error {
+	prefix := namespacePrefix(n)
+	if prefix == "" {
+		return fmt.Errorf("%w: default namespace declared twice", ErrMalformed)
+	}
+	return fmt.Errorf("%w: %s namespace prefix declared twice", ErrMalformed, prefix)
+}
+
+type scope struct {
+	ns       map[string]string
+	prefixes []string
+	base     *url.URL
+	preserve bool
+}
+
+func (r *Reader) pushScope(attrs []Attr) error {
+	var curr scope
+	if z := len(r.scopes); z > 0 {
+		curr.base = r.scopes[z-1].base
+		curr.preserve = r.scopes[z-1].preserve
+	}
+	for _, a := range attrs {
+		if a.NS == "xml" && a.Name.Name == "space" {
+			curr.preserve = a.Value == "preserve"
+		}
+		if a.NS == "xml" && a.Name.Name == "base" {
+			base, err := url.Parse(a.Value)
+			if err != nil {
+				return fmt.Errorf("%w: invalid xml:base %s", ErrMalformed, a.Value)
+			}
+			if curr.base != nil {
+				base = curr.base.ResolveReference(base)
+			}
+			curr.base = base
+		}
+		if !isNamespaceDecl(a.Name) {
+			continue
+		}
+		if curr.ns == nil {
+			curr.ns = make(map[string]string)
+		}
+		prefix := namespacePrefix(a.Name)
+		curr.ns[prefix] = a.Value
+		curr.prefixes = append(curr.prefixes, prefix)
+	}
+	r.scopes = append(r.scopes, curr)
+	return nil
+}
+
+func (r *Reader) scopePrefixes() []string {
+	if z := len(r.scopes); z > 0 {
+		return r.scopes[z-1].prefixes
+	}
+	return nil
+}
+
+func (r *Reader) popScope() {
+	if z := len(r.scopes); z > 0 {
+		r.scopes = r.scopes[:z-1]
+	}
+}
+
+func (r *Reader) SetStackMatchByURI(match bool) {
+	r.matchURI = match
+}
+
+func (r *Reader) matchOpen(open, close Name) bool {
+	return open.Equal(close) || (r.matchURI && r.sameURI(open, close))
+}
+
+func (r *Reader) sameURI(left, right Name) bool {
+	if left.Name != right.Name {
+		return false
+	}
+	u1, ok1 := r.lookupNS(left.NS)
+	u2, ok2 := r.lookupNS(right.NS)
+	return ok1 && ok2 && u1 == u2
+}
+
+func (r *Reader) lookupNS(prefix string) (string, bool) {
+	if prefix == "xml" {
+		return xmlURI, true
+	}
+	if prefix == xmlns {
+		return xmlnsURI, true
+	}
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		if uri, ok := r.scopes[i].ns[prefix]; ok {
+			return uri, true
+		}
+	}
+	return "", false
+}
+
+func (r *Reader) ResolveURI(ref string) (string, error) {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	if z := len(r.scopes); z > 0 && r.scopes[z-1].base != nil {
+		u = r.scopes[z-1].base.ResolveReference(u)
+	}
+	return u.String(), nil
+}
+
+func (r *Reader) resolveElement(n *Node) error {
+	if err := r.pushScope(n.Attrs); err != nil {
+		return err
+	}
+	r.release = n.SelfClosing
+	var err error
+	if n.Name, err = r.resolve(n.Name, false); err != nil {
+		return err
+	}
+	attrs := n.Attrs[:0]
+	for _, a := range n.Attrs {
+		if r.filter != nil && !r.filter(n.Name, a.Name, r.attrURI(a.Name)) {
+			continue
+		}
+		if a.Name, err = r.resolve(a.Name, true); err != nil {
+			return err
+		}
+		attrs = append(attrs, a)
+	}
+	n.Attrs = attrs
+	return nil
+}
+
+func (r *Reader) attrURI(n Name) string {
+	if isNamespaceDecl(n) {
+		return xmlnsURI
+	}
+	if n.NS == "" {
+		return ""
+	}
+	uri, _ := r.lookupNS(n.NS)
+	return uri
+}
+
+type NameNormalizer func(Name) Name
+
+func LowerCase(n Name) Name {
+	n.Name = strings.ToLower(n.Name)
+	return n
+}
+
+func UpperCase(n Name) Name {
+	n.Name = strings.ToUpper(n.Name)
+	return n
+}
+
+func TrimNamespace(n Name) Name {
+	if ix := strings.LastIndexByte(n.Name, ':'); ix >= 0 {
+		n.Name = n.Name[ix+1:]
+	}
+	n.NS = ""
+	return n
+}
+
+func (r *Reader) SetNormalizeNames(fn NameNormalizer) {
+	r.normalize = fn
+}
+
+func (r *Reader) resolve(n Name, attr bool) (Name, error) {
+	n, err := r.resolveName(n, attr)
+	if err == nil && r.normalize != nil && !isNamespaceDecl(n) {
+		n = r.normalize(n)
+	}
+	return n, err
+}
+
+func (r *Reader) resolveName(n Name, attr bool) (Name, error) {
+	if r.noNS || isNamespaceDecl(n) {
+		return n, nil
+	}
+	if r.nsmode == NSPrefix {
+		if r.prefixMapper != nil && n.NS != "" {
+			n.NS = r.prefixMapper(n.NS)
+		}
+		return n, nil
+	}
+	if attr && n.NS == "" {
+		return n, nil
+	}
+	uri, ok := r.lookupNS(n.NS)
+	if !ok {
+		if n.NS == "" {
+			return n, nil
+		}
+		return n, fmt.Errorf("%w: %s unbound prefix", ErrMalformed, n.NS)
+	}
+	switch r.nsmode {
+	case NSResolvedURI:
+		n.NS = uri
+	case NSCanonical:
+		n.NS = r.canonicalPrefix(uri)
+	}
+	return n, nil
+}
+
+func (r *Reader) canonicalPrefix(uri string) string {
+	if uri == "" {
+		return ""
+	}
+	if r.canon == nil {
+		r.canon = make(map[string]string)
+	}
+	prefix, ok := r.canon[uri]
+	if !ok {
+		h := fnv.New32a()
+		io.WriteString(h, uri)
+		prefix = fmt.Sprintf("ns%08x", h.Sum32())
+		r.canon[uri] = prefix
+	}
+	return prefix
+}
@@ -0,0 +1,239 @@
+package sax
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNamespaceModes(t *testing.T) {
+	docs := []string{
+		`<sax:foo xmlns:sax="urn:sax" sax:a="1"/>`,
+		`<o:bar xmlns:o="urn:other"><s:foo xmlns:s="urn:sax" s:a="1"/></o:bar>`,
+	}
+	for _, mode := range []NamespaceMode{NSResolvedURI, NSCanonical} {
+		var names []Name
+		for _, doc := range docs {
+			r := New(strings.NewReader(doc), nil)
+			r.SetNamespaceMode(mode)
+			n, err := r.Find(func(n *Node) bool {
+				return n.Name.Name == "foo"
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			names = append(names, n.Name)
+			for _, a := range n.Attrs {
+				if a.Name.Name == "a" {
+					names = append(names, a.Name)
+				}
+			}
+		}
+		if len(names) != 4 {
+			t.Fatalf("mode %d: unexpected names %v", mode, names)
+		}
+		if !names[0].Equal(names[2]) || names[0].String() != names[2].String() {
+			t.Errorf("mode %d: elements differ: %s vs %s", mode, names[0], names[2])
+		}
+		if !names[1].Equal(names[3]) || names[1].String() != names[3].String() {
+			t.Errorf("mode %d: attributes differ: %s vs %s", mode, names[1], names[3])
+		}
+	}
+}
+
+func TestAttrFilterNamespace(t *testing.T) {
+	const doc = `<r xmlns:m="http://example.com/meta" xmlns:k="urn:keep" m:id="1" k:id="2" id="3"><c m:x="4" y="5"/></r>`
+	r := New(strings.NewReader(doc), nil)
+	r.SetAttrFilter(func(_, _ Name, uri string) bool {
+		return uri != "http://example.com/meta"
+	})
+	nodes, err := readAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var got []string
+	for _, n := range nodes {
+		for _, a := range n.Attrs {
+			got = append(got, a.Fqn())
+		}
+	}
+	want := []string{"xmlns:m", "xmlns:k", "k:id", "id", "y"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("filtered attributes mismatched: want %q, got %q", want, got)
+	}
+}
+
+func TestDuplicatedNamespace(t *testing.T) {
+	tests := []struct {
+		Doc  string
+		Want string
+	}{
+		{Doc: `<r xmlns:a="u1" xmlns:a="u2"/>`, Want: "a namespace prefix declared twice"},
+		{Doc: `<r xmlns="a" xmlns="b"/>`, Want: "default namespace declared twice"},
+	}
+	for _, tt := range tests {
+		r := New(strings.NewReader(tt.Doc), nil)
+		r.SetMode(ModeStrict)
+		err := r.Run()
+		if !errors.Is(err, ErrMalformed) || !strings.Contains(err.Error(), tt.Want) {
+			t.Errorf("%s: want %q error, got %v", tt.Doc, tt.Want, err)
+		}
+	}
+}
+
+func TestResolveURI(t *testing.T) {
+	const doc = `<r xml:base="http://example.com/docs/"><s xml:base="guide/"><a href="intro.html"/></s></r>`
+	r := New(strings.NewReader(doc), nil)
+	n, err := r.Find(func(n *Node) bool {
+		return n.Name.Name == "a"
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	got, err := r.ResolveURI(n.Attrs[0].Value)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if want := "http://example.com/docs/guide/intro.html"; got != want {
+		t.Errorf("resolved URI mismatched: want %s, got %s", want, got)
+	}
+}
+
+func TestPrefixMapper(t *testing.T) {
+	const doc = `<Sax:Root xmlns:Sax="urn:sax"><Sax:Item/><sAX:Item xmlns:sAX="urn:sax"></SAX:Item></Sax:Root>`
+	r := New(strings.NewReader(doc), nil)
+	r.SetPrefixMapper(strings.ToLower)
+	nodes, err := readAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var got []string
+	for _, n := range nodes {
+		got = append(got, n.Fqn())
+	}
+	want := []string{"sax:Root", "sax:Item", "sax:Item", "sax:Item", "sax:Root"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("names mismatched: want %q, got %q", want, got)
+	}
+}
+
+func TestNamespaceUnaware(t *testing.T) {
+	r := New(strings.NewReader(`<foo:bar foo:a="1"></foo:bar>`), nil)
+	r.SetNamespaceAware(false)
+	nodes, err := readAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, n := range nodes {
+		if n.NS != "" || n.Name.Name != "foo:bar" {
+			t.Errorf("want single local name foo:bar, got %+v", n.Name)
+		}
+	}
+	if a := nodes[0].Attrs[0]; a.NS != "" || a.Name.Name != "foo:a" {
+		t.Errorf("want single local attribute name foo:a, got %+v", a.Name)
+	}
+}
+
+func TestNamespaceEvents(t *testing.T) {
+	const doc = `<r xmlns:p="u1"><p:a xmlns:p="u2" xmlns:q="u3"><b xmlns="d"/></p:a></r>`
+	r := New(strings.NewReader(doc), nil)
+	var got []string
+	r.OnBeginElement(func(n Name) error {
+		got = append(got, "<"+n.Fqn())
+		return nil
+	})
+	r.OnEndElement(func(n Name) error {
+		got = append(got, "/"+n.Fqn())
+		return nil
+	})
+	r.OnNamespace(func(prefix, uri string) error {
+		got = append(got, "+"+prefix+"="+uri)
+		return nil
+	})
+	r.OnNamespaceEnd(func(prefix string) error {
+		got = append(got, "-"+prefix)
+		return nil
+	})
+	if err := r.Run(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := []string{
+		"+p=u1", "<r",
+		"+p=u2", "+q=u3", "<p:a",
+		"+=d", "<b", "-",
+		"/p:a", "-p", "-q",
+		"/r", "-p",
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("events mismatched:\nwant %q\ngot  %q", want, got)
+	}
+}
+
+func TestStackMatchByURI(t *testing.T) {
+	const doc = `<r xmlns:a="u" xmlns:b="u"><a:x></b:x></r>`
+	tests := []struct {
+		Name  string
+		Mode  Mode
+		URI   bool
+		Want  string
+		Fail  bool
+		Warns bool
+	}{
+		{Name: "strict", Mode: ModeStrict, Fail: true},
+		{Name: "strict+uri", Mode: ModeStrict, URI: true, Want: "+a +b <r <a:x /b:x /r -a -b"},
+		{Name: "lenient", Mode: ModeLenient, Warns: true, Want: "+a +b <r <a:x /a:x /r -a -b"},
+		{Name: "lenient+uri", Mode: ModeLenient, URI: true, Want: "+a +b <r <a:x /b:x /r -a -b"},
+	}
+	for _, tt := range tests {
+		var (
+			r        = New(strings.NewReader(doc), nil)
+			events   = recordEvents(r)
+			warnings int
+		)
+		r.SetMode(tt.Mode)
+		r.SetStackMatchByURI(tt.URI)
+		r.OnWarning(func(string) error {
+			warnings++
+			return nil
+		})
+		err := r.Run()
+		if tt.Fail {
+			if !errors.Is(err, ErrMalformed) {
+				t.Errorf("%s: expected ErrMalformed, got %v", tt.Name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.Name, err)
+			continue
+		}
+		if got := strings.Join(*events, " "); got != tt.Want {
+			t.Errorf("%s: events mismatched: want %q, got %q", tt.Name, tt.Want, got)
+		}
+		if got := warnings > 0; got != tt.Warns {
+			t.Errorf("%s: want warnings %t, got %d", tt.Name, tt.Warns, warnings)
+		}
+	}
+}
+
+func TestNormalizeTrimNamespace(t *testing.T) {
+	const doc = `<sax:root xmlns:sax="http://localhost"><sax:foo sax:a="1">text</sax:foo><foo/></sax:root>`
+	r := New(strings.NewReader(doc), nil)
+	r.SetNormalizeNames(TrimNamespace)
+	events := recordEvents(r)
+	var attrs []string
+	r.OnAttribute(func(n Name, _ string) error {
+		attrs = append(attrs, n.Fqn())
+		return nil
+	})
+	if err := r.Run(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := "+sax <root <foo /foo <foo /root -sax"
+	if got := strings.Join(*events, " "); got != want {
+		t.Errorf("events mismatched: want %q, got %q", want, got)
+	}
+	if strings.Join(attrs, " ") != "xmlns:sax a" {
+		t.Errorf("attributes mismatched: got %q", attrs)
+	}
+}
@@ -0,0 +1,132 @@
+package sax
+
+// SetPostOrder makes Read return the nodes of each top level element in
+// post-order: the children of an element are returned before the element
+// itself, and the begin and end nodes of an element are returned next to each
+// other once its whole subtree has been read. Nodes outside of elements keep
+// their document order. Listeners fire in the same order as the nodes are
+// returned, and Depth and Locator report the values saved when the node was
+// parsed. The subtree of the element being read is kept in memory until it is
+// closed, so memory grows with the size of the largest top level element.
+func (r *Reader) SetPostOrder(post bool) {
+	r.postOrder = post
+}
+
+func (r *Reader) nextEvent() (*Node, error) {
+	if r.postOrder {
+		recording := r.listeners.recording
+		r.listeners.recording = true
+		defer func() {
+			r.listeners.recording = recording
+		}()
+	}
+	n, err := r.next()
+	if err == nil {
+		r.trackSiblings(n)
+	}
+	if err == nil && r.rejectMixed {
+		err = r.checkMixed(n)
+	}
+	return n, err
+}
+
+type replayed struct {
+	node   *Node
+	events []func() error
+	depth  int
+	pos    Position
+}
+
+type frame struct {
+	begin replayed
+	nodes []replayed
+}
+
+func (r *Reader) collectPostOrder(n *Node) (*Node, error) {
+	if n.Type != BeginElement || n.SelfClosing {
+		r.replay = append(r.replay, r.replayed(n))
+		return r.popReplay()
+	}
+	into := r.into
+	defer func() {
+		r.into = into
+	}()
+	r.into = nil
+
+	var (
+		root   = *n
+		depth  = len(r.stack)
+		frames = []frame{{}, {begin: r.replayed(&root)}}
+	)
+	for len(r.stack) >= depth {
+		n, err := r.nextEvent()
+		if err != nil {
+			return nil, err
+		}
+		var (
+			curr = r.replayed(n)
+			top  = &frames[len(frames)-1]
+		)
+		switch {
+		case n.Type == BeginElement && !n.SelfClosing:
+			frames = append(frames, frame{begin: curr})
+		case n.Type == EndElement:
+			top.nodes = append(top.nodes, top.begin, curr)
+			frames = frames[:len(frames)-1]
+			parent := &frames[len(frames)-1]
+			parent.nodes = append(parent.nodes, top.nodes...)
+		default:
+			top.nodes = append(top.nodes, curr)
+		}
+	}
+	r.replay = append(r.replay, frames[0].nodes...)
+	return r.popReplay()
+}
+
+func (r *Reader) replayed(n *Node) replayed {
+	return replayed{
+		node:   n,
+		events: r.takeRecorded(),
+		depth:  len(r.stack),
+		pos:    r.event,
+	}
+}
+
+func (r *Reader) popReplay() (*Node, error) {
+	e := r.replay[0]
+	r.replay = r.replay[1:]
+	r.count++
+	r.replaying, r.replayDepth, r.event = true, e.depth, e.pos
+	return e.node, r.fire(e.events)
+}
+
+func (r *Reader) record(fn func() error) error {
+	r.listeners.recorded = append(r.listeners.recorded, fn)
+	return nil
+}
+
+func (r *Reader) takeRecorded() []func() error {
+	events := r.listeners.recorded
+	r.listeners.recorded = nil
+	return events
+}
+
+func (r *Reader) flushRecorded() error {
+	if len(r.listeners.recorded) == 0 {
+		return nil
+	}
+	return r.fire(r.takeRecorded())
+}
+
+func (r *Reader) fire(events []func() error) error {
+	if r.listeners.peeking {
+		r.listeners.recorded = append(r.listeners.recorded, events...)
+		return nil
+	}
+	for _, fn := range events {
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package sax
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestPostOrderEvents(t *testing.T) {
+	const doc = `<r xmlns:p="urn:p"><p:a><b/>text</p:a></r>`
+	r := New(strings.NewReader(doc), nil)
+	r.SetPostOrder(true)
+	events := recordEvents(r)
+	r.OnRawTag(func(str string) error {
+		*events = append(*events, str)
+		return nil
+	})
+	var got []string
+	for {
+		n, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		got = append(got, fmt.Sprintf("%s(%d) %s", n.Name, r.Depth(), strings.Join(*events, " ")))
+		*events = (*events)[:0]
+	}
+	want := []string{
+		`b(2) <b <b/>`,
+		`(2) `,
+		`p:a(2) <p:a <p:a>`,
+		`p:a(1) /p:a </p:a>`,
+		`r(1) +p <r <r xmlns:p="urn:p">`,
+		`r(0) /r -p </r>`,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("unexpected nodes: %q", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("node %d: want %q, got %q", i, want[i], got[i])
+		}
+	}
+}
+
+func TestAttributeEventOrder(t *testing.T) {
+	const doc = `<r a="1" b="2"><c d="3">text<e f="4"/></c></r>`
+	want := "<r @a @b <c @d text <e @f /c /r"
+	for _, lazy := range []bool{false, true} {
+		r := New(strings.NewReader(doc), nil)
+		r.SetLazyAttrs(lazy)
+		events := recordEvents(r)
+		r.OnAttribute(func(n Name, _ string) error {
+			*events = append(*events, "@"+n.Fqn())
+			return nil
+		})
+		r.OnText(func(str string) error {
+			*events = append(*events, str)
+			return nil
+		})
+		if err := r.Run(); err != nil {
+			t.Fatalf("lazy %t: unexpected error: %s", lazy, err)
+		}
+		if got := strings.Join(*events, " "); got != want {
+			t.Errorf("lazy %t: events mismatched: want %q, got %q", lazy, want, got)
+		}
+	}
+}
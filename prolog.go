@@ -0,0 +1,171 @@
+package sax
+
+import (
+	"fmt"
+)
+
+type Prolog struct {
+	Version    string
+	Encoding   string
+	Standalone string
+	DocType    string
+	Nodes      []*Node
+}
+
+func (r *Reader) ReadProlog() (*Prolog, error) {
+	var p Prolog
+	for {
+		n, err := r.PeekNode()
+		if err != nil {
+			return &p, err
+		}
+		if n.Type == BeginElement || n.Type == EndElement {
+			return &p, nil
+		}
+		if _, err := r.Read(); err != nil {
+			return nil, err
+		}
+		switch n.Type {
+		case ProcInst:
+			if n.Name.Name == "xml" && n.NS == "" {
+				p.readDeclaration(n)
+				break
+			}
+			p.Nodes = append(p.Nodes, n)
+		case Comment:
+			p.Nodes = append(p.Nodes, n)
+		case DocType:
+			p.DocType = n.Content
+		}
+	}
+}
+
+func (r *Reader) ExpectRoot(name Name) (*Node, error) {
+	if _, err := r.ReadProlog(); err != nil {
+		return nil, err
+	}
+	n, err := r.PeekNode()
+	if err != nil {
+		return nil, err
+	}
+	if n.Type != BeginElement || !n.Name.Equal(name) {
+		return nil, fmt.Errorf("%w: unexpected root %s! want %s", ErrMalformed, n.Name, name)
+	}
+	return r.Read()
+}
+
+var declarationAttrs = []string{"version", "encoding", "standalone"}
+
+func validateDeclaration(n *Node) error {
+	if len(n.Attrs) == 0 || n.Attrs[0].Fqn() != "version" {
+		return fmt.Errorf("%w: version must be the first pseudo-attribute of the xml declaration", ErrMalformed)
+	}
+	var offset int
+	for _, a := range n.Attrs {
+		i := offset
+		for i < len(declarationAttrs) && declarationAttrs[i] != a.Fqn() {
+			i++
+		}
+		if i >= len(declarationAttrs) {
+			return fmt.Errorf("%w: %s unexpected or misplaced in xml declaration", ErrMalformed, a.Name)
+		}
+		offset = i + 1
+		if a.Fqn() == "standalone" && a.Value != "yes" && a.Value != "no" {
+			return fmt.Errorf("%w: standalone should be yes or no", ErrMalformed)
+		}
+	}
+	return nil
+}
+
+func (p *Prolog) readDeclaration(n *Node) {
+	for _, a := range n.Attrs {
+		switch a.Name.Name {
+		case "version":
+			p.Version = a.Value
+		case "encoding":
+			p.Encoding = a.Value
+		case "standalone":
+			p.Standalone = a.Value
+		}
+	}
+}
+
+func (r *Reader) collectInstruction(n *Node) {
+	switch n.Fqn() {
+	case "xml-model":
+		r.models = append(r.models, readSchemaModel(n))
+	case "xml-stylesheet":
+		r.stylesheets = append(r.stylesheets, readStylesheet(n))
+	}
+}
+
+type SchemaModel struct {
+	Href         string
+	Type         string
+	SchemaTypeNS string
+	Charset      string
+	Title        string
+	Group        string
+	Phase        string
+}
+
+func (r *Reader) SchemaModels() []SchemaModel {
+	return r.models
+}
+
+func readSchemaModel(n *Node) SchemaModel {
+	var m SchemaModel
+	for _, a := range n.Attrs {
+		switch a.Name.Name {
+		case "href":
+			m.Href = a.Value
+		case "type":
+			m.Type = a.Value
+		case "schematypens":
+			m.SchemaTypeNS = a.Value
+		case "charset":
+			m.Charset = a.Value
+		case "title":
+			m.Title = a.Value
+		case "group":
+			m.Group = a.Value
+		case "phase":
+			m.Phase = a.Value
+		}
+	}
+	return m
+}
+
+type Stylesheet struct {
+	Href      string
+	Type      string
+	Title     string
+	Media     string
+	Charset   string
+	Alternate bool
+}
+
+func (r *Reader) Stylesheets() []Stylesheet {
+	return r.stylesheets
+}
+
+func readStylesheet(n *Node) Stylesheet {
+	var s Stylesheet
+	for _, a := range n.Attrs {
+		switch a.Name.Name {
+		case "href":
+			s.Href = a.Value
+		case "type":
+			s.Type = a.Value
+		case "title":
+			s.Title = a.Value
+		case "media":
+			s.Media = a.Value
+		case "charset":
+			s.Charset = a.Value
+		case "alternate":
+			s.Alternate = a.Value == "yes"
+		}
+	}
+	return s
+}
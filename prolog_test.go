@@ -0,0 +1,126 @@
+package sax
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestReadProlog(t *testing.T) {
+	const doc = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<!DOCTYPE root>
+<!-- comment -->
+<?pi data="1"?>
+<root><child/></root>`
+	r := New(strings.NewReader(doc), nil)
+	p, err := r.ReadProlog()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if p.Version != "1.0" || p.Encoding != "UTF-8" || p.Standalone != "yes" {
+		t.Errorf("declaration mismatched: %+v", p)
+	}
+	if p.DocType != "root" {
+		t.Errorf("doctype mismatched: want %q, got %q", "root", p.DocType)
+	}
+	if len(p.Nodes) != 2 || p.Nodes[0].Type != Comment || p.Nodes[1].Type != ProcInst {
+		t.Errorf("leading nodes mismatched: %v", p.Nodes)
+	}
+	n, err := r.Read()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n.Type != BeginElement || n.Name.Name != "root" {
+		t.Errorf("root expected after prolog, got %s %s", n.Type, n.Name)
+	}
+	if d := r.Depth(); d != 1 {
+		t.Errorf("depth mismatched: want 1, got %d", d)
+	}
+}
+
+func TestSchemaModels(t *testing.T) {
+	const doc = `<?xml version="1.0"?>
+<?xml-model href="doc.rng" schematypens="http://relaxng.org/ns/structure/1.0"?>
+<?xml-model href="doc.sch" type="application/xml" schematypens="http://purl.oclc.org/dsdl/schematron" phase="all"?>
+<root/>`
+	r := New(strings.NewReader(doc), nil)
+	if err := r.Run(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := []SchemaModel{
+		{Href: "doc.rng", SchemaTypeNS: "http://relaxng.org/ns/structure/1.0"},
+		{Href: "doc.sch", Type: "application/xml", SchemaTypeNS: "http://purl.oclc.org/dsdl/schematron", Phase: "all"},
+	}
+	got := r.SchemaModels()
+	if len(got) != len(want) {
+		t.Fatalf("schema models mismatched: want %d, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("schema model %d mismatched: want %+v, got %+v", i, want[i], got[i])
+		}
+	}
+}
+
+func TestDeclarationOrder(t *testing.T) {
+	tests := []struct {
+		Decl  string
+		Valid bool
+	}{
+		{Decl: `<?xml version="1.0"?>`, Valid: true},
+		{Decl: `<?xml version="1.0" encoding="UTF-8" standalone="no"?>`, Valid: true},
+		{Decl: `<?xml encoding="UTF-8" version="1.0"?>`},
+		{Decl: `<?xml version="1.0" standalone="yes" encoding="UTF-8"?>`},
+		{Decl: `<?xml encoding="UTF-8"?>`},
+		{Decl: `<?xml version="1.0" other="x"?>`},
+	}
+	for _, tt := range tests {
+		r := New(strings.NewReader(tt.Decl+"<root/>"), nil)
+		r.SetMode(ModeStrict)
+		err := r.Run()
+		if tt.Valid && err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.Decl, err)
+		}
+		if !tt.Valid && !errors.Is(err, ErrMalformed) {
+			t.Errorf("%s: want %s, got %v", tt.Decl, ErrMalformed, err)
+		}
+	}
+}
+
+func TestStylesheets(t *testing.T) {
+	const doc = `<?xml-stylesheet href="a.css" type="text/css" title="A" media="screen"?>
+<?xml-stylesheet href="b.xsl" type="text/xsl" alternate="yes"?>
+<root><skip><?xml-stylesheet href="c.css"?></skip></root>`
+	skip := func(t NodeType, n Name) error {
+		if t == BeginElement && n.Name == "skip" {
+			return ErrIgnore
+		}
+		return nil
+	}
+	r := New(strings.NewReader(doc), skip)
+	if err := r.Run(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := []Stylesheet{
+		{Href: "a.css", Type: "text/css", Title: "A", Media: "screen"},
+		{Href: "b.xsl", Type: "text/xsl", Alternate: true},
+	}
+	got := r.Stylesheets()
+	if len(got) != len(want) {
+		t.Fatalf("stylesheets mismatched: want %d, got %d (%+v)", len(want), len(got), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("stylesheet %d mismatched: want %+v, got %+v", i, want[i], got[i])
+		}
+	}
+
+	r = New(strings.NewReader(doc), nil)
+	r.SetPITargets("xml-model")
+	if err := r.Run(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := r.Stylesheets(); len(got) != 0 {
+		t.Errorf("filtered stylesheets collected: %+v", got)
+	}
+}
@@ -0,0 +1,159 @@
+package sax
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+)
+
+var errAbandoned = errors.New("push parser abandoned")
+
+// PushParser parses a document fed in chunks by the caller. The chunks are
+// read by a Reader running in its own goroutine. That goroutine ends when
+// the input is complete, when Close is called or, if the parser is dropped
+// without being closed, once the parser is garbage collected.
+type PushParser struct {
+	*pushState
+}
+
+type pushState struct {
+	chunks  chan []byte
+	hungry  chan struct{}
+	results chan pushResult
+	done    chan struct{}
+	closed  bool
+	err     error
+}
+
+type pushResult struct {
+	node *Node
+	err  error
+}
+
+func NewPushParser(keep KeepFunc) *PushParser {
+	s := pushState{
+		chunks:  make(chan []byte),
+		hungry:  make(chan struct{}),
+		results: make(chan pushResult),
+		done:    make(chan struct{}),
+	}
+	go s.run(keep)
+	s.collect()
+
+	p := PushParser{pushState: &s}
+	runtime.SetFinalizer(&p, func(p *PushParser) {
+		close(p.done)
+	})
+	return &p
+}
+
+// Feed gives the next chunk of the document to the parser and returns the
+// nodes completed by it. Nodes that can only be completed by the end of the
+// input, like text after the root element, are not reported.
+func (p *PushParser) Feed(b []byte) ([]*Node, error) {
+	if p.closed {
+		return nil, fmt.Errorf("push parser closed")
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	if len(b) == 0 {
+		return nil, nil
+	}
+	p.chunks <- append([]byte{}, b...)
+	return p.collect()
+}
+
+// Close signals the end of the input and waits for the parser to stop. It
+// reports the error detected at the end of the document, if any.
+func (p *PushParser) Close() error {
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	if p.err == nil {
+		close(p.chunks)
+		p.collect()
+	}
+	if errors.Is(p.err, io.EOF) {
+		return nil
+	}
+	return p.err
+}
+
+func (s *pushState) collect() ([]*Node, error) {
+	var nodes []*Node
+	for {
+		select {
+		case <-s.hungry:
+			return nodes, nil
+		case res := <-s.results:
+			if res.err != nil {
+				s.err = res.err
+				return nodes, res.err
+			}
+			nodes = append(nodes, res.node)
+		}
+	}
+}
+
+func (s *pushState) run(keep KeepFunc) {
+	src := pushSource{state: s}
+	rs := New(&src, keep)
+	src.reader = rs
+	rs.incremental = true
+	for {
+		n, err := rs.Read()
+		select {
+		case s.results <- pushResult{node: n, err: err}:
+		case <-s.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+type pushSource struct {
+	state  *pushState
+	reader *Reader
+	buf    []byte
+	closed bool
+}
+
+func (s *pushSource) Read(b []byte) (int, error) {
+	if len(s.buf) == 0 {
+		if s.closed {
+			return 0, io.EOF
+		}
+		// blanks following a node are skipped with the data at hand so that
+		// the node is returned by the Feed that completed it.
+		if s.reader != nil && s.reader.trailing {
+			return 0, io.EOF
+		}
+		select {
+		case s.state.hungry <- struct{}{}:
+		case <-s.state.done:
+			return 0, errAbandoned
+		}
+		var (
+			chunk []byte
+			ok    bool
+		)
+		select {
+		case chunk, ok = <-s.state.chunks:
+		case <-s.state.done:
+			return 0, errAbandoned
+		}
+		if !ok {
+			s.closed = true
+			return 0, io.EOF
+		}
+		s.buf = chunk
+	}
+	n := copy(b, s.buf)
+	s.buf = s.buf[n:]
+	return n, nil
+}
@@ -0,0 +1,82 @@
+package sax
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPushParserOneByte(t *testing.T) {
+	want, err := readAll(New(strings.NewReader(sample), nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var (
+		p   = NewPushParser(nil)
+		got []*Node
+	)
+	for i := 0; i < len(sample); i++ {
+		nodes, err := p.Feed([]byte{sample[i]})
+		if err != nil {
+			t.Fatalf("offset %d: unexpected error: %s", i, err)
+		}
+		got = append(got, nodes...)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("want %d nodes, got %d", len(want), len(got))
+	}
+	for i := range want {
+		w := fmt.Sprintf("%s %s %q %v", want[i].Type, want[i].Fqn(), want[i].Content, want[i].Attrs)
+		g := fmt.Sprintf("%s %s %q %v", got[i].Type, got[i].Fqn(), got[i].Content, got[i].Attrs)
+		if w != g {
+			t.Errorf("node %d mismatched:\nwant %s\ngot  %s", i, w, g)
+		}
+	}
+}
+
+func TestPushParserClose(t *testing.T) {
+	p := NewPushParser(nil)
+	nodes, err := p.Feed([]byte("<root><a/></root>\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(nodes) != 3 {
+		t.Errorf("want 3 nodes from the last feed, got %d", len(nodes))
+	}
+	if err := p.Close(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if _, err := p.Feed([]byte("<other/>")); err == nil {
+		t.Errorf("expected error feeding a closed parser")
+	}
+
+	p = NewPushParser(nil)
+	if _, err := p.Feed([]byte("<root><a></b>")); !errors.Is(err, ErrMalformed) {
+		t.Errorf("expected ErrMalformed, got %v", err)
+	}
+	if err := p.Close(); !errors.Is(err, ErrMalformed) {
+		t.Errorf("expected ErrMalformed on close, got %v", err)
+	}
+}
+
+func TestPushParserAbandoned(t *testing.T) {
+	before := runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		p := NewPushParser(nil)
+		p.Feed([]byte("<root><a>text"))
+	}
+	for i := 0; i < 50; i++ {
+		runtime.GC()
+		if runtime.NumGoroutine() <= before {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("goroutines of abandoned parsers still running: %d > %d", runtime.NumGoroutine(), before)
+}
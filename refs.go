@@ -0,0 +1,48 @@
+package sax
+
+import (
+	"errors"
+	"io"
+)
+
+func ValidateReferences(rs io.Reader, idAttr, refAttr string) ([]string, error) {
+	var (
+		rd   = New(rs, nil)
+		ids  = make(map[string]struct{})
+		seen = make(map[string]struct{})
+		refs []string
+	)
+	for {
+		n, err := rd.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		if n.Type != BeginElement {
+			continue
+		}
+		for _, a := range n.Attrs {
+			switch a.Fqn() {
+			case idAttr:
+				ids[a.Value] = struct{}{}
+			case refAttr:
+				for _, ref := range a.Tokens() {
+					if _, ok := seen[ref]; ok {
+						continue
+					}
+					seen[ref] = struct{}{}
+					refs = append(refs, ref)
+				}
+			}
+		}
+	}
+	var unresolved []string
+	for _, ref := range refs {
+		if _, ok := ids[ref]; !ok {
+			unresolved = append(unresolved, ref)
+		}
+	}
+	return unresolved, nil
+}
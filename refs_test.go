@@ -0,0 +1,23 @@
+package sax
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateReferences(t *testing.T) {
+	const doc = `<doc>
+  <see ref="b missing"/>
+  <item xml:id="a"/>
+  <item xml:id="b"><see ref="a"/></item>
+  <see ref="other missing"/>
+</doc>`
+	got, err := ValidateReferences(strings.NewReader(doc), "xml:id", "ref")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := []string{"missing", "other"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("unresolved references mismatched: want %q, got %q", want, got)
+	}
+}
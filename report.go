@@ -0,0 +1,28 @@
+package sax
+
+import (
+	"fmt"
+)
+
+type Recovery struct {
+	Name Name
+	Position
+}
+
+func (r Recovery) String() string {
+	return fmt.Sprintf("%s: %s", r.Position, r.Name)
+}
+
+type Report struct {
+	AutoClosed []Recovery
+	Dropped    []Recovery
+	Unclosed   []Name
+}
+
+func (r *Reader) Report() Report {
+	rp := r.report
+	rp.AutoClosed = append([]Recovery{}, rp.AutoClosed...)
+	rp.Dropped = append([]Recovery{}, rp.Dropped...)
+	rp.Unclosed = append([]Name{}, r.stack...)
+	return rp
+}
@@ -0,0 +1,30 @@
+package sax
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestReport(t *testing.T) {
+	const doc = "<r><a><b>x</a></c>\n<d><e>y</d></f>"
+	r := New(strings.NewReader(doc), nil)
+	r.SetMode(ModeLenient)
+	if _, err := readAll(r); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	rp := r.Report()
+	for _, c := range []struct {
+		Name string
+		Got  interface{}
+		Want string
+	}{
+		{Name: "auto closed", Got: rp.AutoClosed, Want: "[1:14: b 2:11: e]"},
+		{Name: "dropped", Got: rp.Dropped, Want: "[1:18: c 2:15: f]"},
+		{Name: "unclosed", Got: rp.Unclosed, Want: "[r]"},
+	} {
+		if got := fmt.Sprint(c.Got); got != c.Want {
+			t.Errorf("%s mismatched: want %s, got %s", c.Name, c.Want, got)
+		}
+	}
+}
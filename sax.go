@@ -1,13 +1,17 @@
 package sax
 
 import (
-	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 const (
@@ -31,6 +35,7 @@ const (
 	ampersand  = '&'
 	semicolon  = ';'
 	pound      = '#'
+	dot        = '.'
 )
 
 var (
@@ -38,8 +43,17 @@ var (
 	ErrIgnore      = errors.New("ignore")
 	ErrStop        = errors.New("stop")
 	ErrUnsubscribe = errors.New("unsubscribe")
+	ErrSkipElement = errors.New("skip element")
 	ErrChar        = errors.New("unepected character")
 	ErrMalformed   = errors.New("malformed document")
+	ErrTimeout     = errors.New("timeout")
+	ErrNodeLimit   = errors.New("node limit reached")
+)
+
+const (
+	maxReference  = 32
+	attrPresize   = 4
+	attrScanLimit = 8
 )
 
 type NodeType rune
@@ -52,6 +66,9 @@ const (
 	Text
 	CData
 	Comment
+	DocType
+	Entity
+	Declaration
 )
 
 func (n NodeType) String() string {
@@ -68,6 +85,12 @@ func (n NodeType) String() string {
 		return "cdata"
 	case Comment:
 		return "comment"
+	case DocType:
+		return "doctype"
+	case Entity:
+		return "entity"
+	case Declaration:
+		return "declaration"
 	default:
 		return "invalid"
 	}
@@ -101,6 +124,28 @@ func (n Name) Equal(other Name) bool {
 	return n.NS == other.NS && n.Name == other.Name
 }
 
+func (n Name) EqualLocal(other Name) bool {
+	return n.Name == other.Name
+}
+
+func ParseName(qname string) (Name, error) {
+	var (
+		rs     = New(strings.NewReader(qname+" "), nil, WithNoInitialSkip())
+		n, err = rs.parseName()
+	)
+	if err == nil {
+		if c, _ := rs.read(); c != space {
+			err = rs.unexpectedChar(c)
+		}
+	}
+	if err == nil {
+		if _, err = rs.read(); errors.Is(err, io.EOF) {
+			return n, nil
+		}
+	}
+	return Name{}, fmt.Errorf("%w: invalid name %q", ErrMalformed, qname)
+}
+
 type Node struct {
 	Type NodeType
 
@@ -108,13 +153,103 @@ type Node struct {
 	Attrs       []Attr
 	Content     string
 	SelfClosing bool
+
+	Raw               string
+	LeadingWhitespace string
+
+	parts  []ContentPart
+	rawLen int
+	expLen int
+	lazy   *lazyAttrs
+}
+
+type lazyAttrs struct {
+	source string
+	raw    bool
+	pos    Position
+}
+
+func (n *Node) Attributes() ([]Attr, error) {
+	if n.lazy == nil {
+		return n.Attrs, nil
+	}
+	rs := New(strings.NewReader(n.lazy.source+string(rangle)), nil)
+	rs.raw = n.lazy.raw
+	rs.pos = n.lazy.pos
+	if err := rs.parseAttributes(n); err != nil {
+		return nil, err
+	}
+	n.lazy = nil
+	return n.Attrs, nil
+}
+
+func (n *Node) ExpansionRatio() float64 {
+	if n.rawLen == 0 {
+		return 1
+	}
+	return float64(n.expLen) / float64(n.rawLen)
+}
+
+func (n *Node) Parts() []ContentPart {
+	return n.parts
+}
+
+func (n *Node) SortedAttrs() []Attr {
+	attrs := make([]Attr, len(n.Attrs))
+	copy(attrs, n.Attrs)
+	sort.SliceStable(attrs, func(i, j int) bool {
+		return attrs[i].Fqn() < attrs[j].Fqn()
+	})
+	return attrs
+}
+
+func (n *Node) AttrTokens(name string) []string {
+	for _, a := range n.Attrs {
+		if a.Fqn() == name {
+			return a.Tokens()
+		}
+	}
+	return nil
 }
 
 type Attr struct {
 	Name
 	Value string
+
+	pos   Position
+	parts []ContentPart
+}
+
+func (a Attr) Parts() []ContentPart {
+	return a.parts
+}
+
+func (a Attr) Tokens() []string {
+	return strings.Fields(a.Value)
 }
 
+type Position struct {
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+type Locator struct {
+	Position
+	SystemID string
+}
+
+type Mode int
+
+const (
+	ModeDefault Mode = iota
+	ModeLenient
+	ModeStrict
+)
+
 type KeepFunc func(NodeType, Name) error
 
 func keepAll(_ NodeType, _ Name) error {
@@ -122,74 +257,597 @@ func keepAll(_ NodeType, _ Name) error {
 }
 
 type Reader struct {
-	rs   *bufio.Reader
-	last rune
-
-	stack []Name
-	keep  KeepFunc
+	rs       runeSource
+	last     rune
+	bom      string
+	declared string
+	charset  Charset
+
+	pos      Position
+	prevPos  Position
+	prevLast rune
+
+	eol     string
+	pending bool
+
+	capture   bytes.Buffer
+	capturing bool
+	layout    bool
+	blanks    bytes.Buffer
+
+	stack    []Name
+	keep     KeepFunc
+	peeked   *Node
+	into     *Node
+	queue    []*Node
+	sibling  int
+	mode     Mode
+	noSkip   bool
+	bufsize  int
+	done     bool
+	rooted   bool
+	preamble int
+
+	timeout time.Duration
+	started time.Time
+
+	maxNodes int
+	count    int
+
+	raw           bool
+	splitEntities bool
+	schema        map[string][]string
+	pattern       *regexp.Regexp
+	postOrder     bool
+	replay        []replayed
+	replaying     bool
+	replayDepth   int
+	seeker        io.ReadSeeker
+	offset        int64
+	lastSize      int
+	marking       bool
+	marked        bytes.Buffer
+	lazyAttrs     bool
+	models        []SchemaModel
+	stylesheets   []Stylesheet
+	trim          TrimMode
+	invalid       InvalidCharPolicy
+	preserveCData bool
+	follow        bool
+	skipping      bool
+	trailing      bool
+	incremental   bool
+	matchURI      bool
+	systemID      string
+	event         Position
+	skipElement   bool
+	rawComments   bool
+	collapse      bool
+	tee           bool
+	spaceAware    bool
+	report        Report
+	types         map[NodeType]struct{}
+	inText        bool
+	tracer        func(string, ...interface{})
+	rejectMixed   bool
+	rejectEOF     bool
+	skipLeading   bool
+	errPolicy     ListenerErrorPolicy
+	errs          []error
+	siblings      struct {
+		counts  []int
+		indices []int
+		closed  int
+	}
+	mixed   []mixedState
+	source  bytes.Buffer
+	ctx     context.Context
+	targets map[string]struct{}
+	nsmode  NamespaceMode
+	filter  AttrFilter
+
+	noNS         bool
+	prefixMapper func(string) string
+	normalize    NameNormalizer
+	scopes       []scope
+	release      bool
+	canon        map[string]string
 
 	listeners struct {
-		silent   bool
+		silent    bool
+		recording bool
+		peeking   bool
+		recorded  []func() error
+
 		begins   []func(Name) error
 		ends     []func(Name) error
 		insts    []func(Name) error
 		attrs    []func(Name, string) error
+		attrsAt  []func(Name, Name, string, int, int) error
 		texts    []func(string) error
 		comments []func(string) error
+		warnings []func(string) error
+		rawTags  []func(string) error
+		nsBegins []func(string, string) error
+		nsEnds   []func(string) error
+
+		cdataStarts []func() error
+		cdataEnds   []func() error
+		dtdStarts   []func(string) error
+		dtdEnds     []func() error
+		textStarts  []func() error
+		textEnds    []func() error
+	}
+}
+
+type Option func(*Reader)
+
+func WithSystemID(id string) Option {
+	return func(r *Reader) {
+		r.systemID = id
+	}
+}
+
+// WithSource keeps a copy of every byte read from the underlying reader so
+// that it can be retrieved with Source. The copy is not bounded: the whole
+// document stays in memory for the lifetime of the Reader.
+func WithSource() Option {
+	return func(r *Reader) {
+		r.tee = true
+	}
+}
+
+func WithBufferSize(size int) Option {
+	return func(r *Reader) {
+		r.bufsize = size
+	}
+}
+
+func WithNoInitialSkip() Option {
+	return func(r *Reader) {
+		r.noSkip = true
 	}
 }
 
-func New(rs io.Reader, keep KeepFunc) *Reader {
+func New(rs io.Reader, keep KeepFunc, options ...Option) *Reader {
 	var r Reader
-	r.rs = bufio.NewReader(rs)
 	if keep == nil {
 		keep = keepAll
 	}
 	r.keep = keep
-	r.skipBlanks()
+	r.preserveCData = true
+	r.pos.Line = 1
+	r.siblings.closed = -1
+	for _, opt := range options {
+		opt(&r)
+	}
+	if s, ok := rs.(io.ReadSeeker); ok && r.charset == UTF8 && !r.tee {
+		if off, err := s.Seek(0, io.SeekCurrent); err == nil {
+			r.seeker, r.offset = s, off
+		}
+	}
+	if r.tee {
+		rs = io.TeeReader(rs, &r.source)
+	}
+	r.rs = newSource(decodeCharset(rs, r.charset), r.bufsize)
+	r.detectBOM()
+	if !r.noSkip {
+		r.skipBlanksInto(&r.blanks)
+	}
 	return &r
 }
 
+func NewMulti(keep KeepFunc, rs ...io.Reader) *Reader {
+	return New(io.MultiReader(rs...), keep)
+}
+
+func (r *Reader) SetPITargets(keep ...string) {
+	if len(keep) == 0 {
+		r.targets = nil
+		return
+	}
+	r.targets = make(map[string]struct{})
+	for _, k := range keep {
+		r.targets[k] = struct{}{}
+	}
+}
+
+func (r *Reader) SetAllowedTypes(types ...NodeType) {
+	if len(types) == 0 {
+		r.types = nil
+		return
+	}
+	r.types = make(map[NodeType]struct{})
+	for _, t := range types {
+		r.types[t] = struct{}{}
+	}
+}
+
+func (r *Reader) allowedType(n *Node) bool {
+	if r.types == nil || (n.Type == ProcInst && n.Name.Name == "xml") {
+		return true
+	}
+	t := n.Type
+	if t == EndElement {
+		t = BeginElement
+	}
+	_, ok := r.types[t]
+	return ok
+}
+
+func (r *Reader) SetKeep(keep KeepFunc) {
+	if keep == nil {
+		keep = keepAll
+	}
+	r.keep = keep
+}
+
+func (r *Reader) SetMode(mode Mode) {
+	r.mode = mode
+}
+
+func (r *Reader) SetSkipPreambleLines(n int) {
+	r.preamble = n
+}
+
+func (r *Reader) SetMaxNodes(n int) {
+	r.maxNodes = n
+}
+
+func (r *Reader) SetTimeout(d time.Duration) {
+	r.timeout = d
+}
+
+func (r *Reader) SetTrimMode(mode TrimMode) {
+	r.trim = mode
+}
+
+func (r *Reader) SetSkipLeadingText(skip bool) {
+	r.skipLeading = skip
+}
+
+func (r *Reader) SetPreserveCData(preserve bool) {
+	r.preserveCData = preserve
+}
+
+func (r *Reader) SetRawComments(raw bool) {
+	r.rawComments = raw
+}
+
+func (r *Reader) SetSplitEntities(split bool) {
+	r.splitEntities = split
+}
+
+func (r *Reader) SetLazyAttrs(lazy bool) {
+	r.lazyAttrs = lazy
+}
+
+func (r *Reader) SetExpandEntities(expand bool) {
+	r.raw = !expand
+}
+
+func (r *Reader) SetNamespaceMode(mode NamespaceMode) {
+	r.nsmode = mode
+}
+
+func (r *Reader) SetNamespaceAware(aware bool) {
+	r.noNS = !aware
+}
+
+func (r *Reader) SetPrefixMapper(fn func(string) string) {
+	r.prefixMapper = fn
+}
+
+func (r *Reader) SetCollapseAttrWhitespace(collapse bool) {
+	r.collapse = collapse
+}
+
+func (r *Reader) SetAttrFilter(fn AttrFilter) {
+	r.filter = fn
+}
+
+func (r *Reader) LineEnding() string {
+	if r.eol == "" {
+		return "\n"
+	}
+	return r.eol
+}
+
 func (r *Reader) Depth() int {
+	if r.replaying {
+		return r.replayDepth
+	}
 	return len(r.stack)
 }
 
+// Source returns the bytes read so far from the underlying reader, exactly
+// as they were received, BOM included. It is empty unless the Reader was
+// created with WithSource.
+func (r *Reader) Source() []byte {
+	return r.source.Bytes()
+}
+
+func (r *Reader) Locator() Locator {
+	return Locator{
+		Position: r.event,
+		SystemID: r.systemID,
+	}
+}
+
+func (r *Reader) Current() (Name, bool) {
+	if len(r.stack) == 0 {
+		return Name{}, false
+	}
+	return r.stack[len(r.stack)-1], true
+}
+
+func (r *Reader) SiblingIndex() int {
+	if r.siblings.closed >= 0 {
+		return r.siblings.closed
+	}
+	if z := len(r.siblings.indices); z > 0 {
+		return r.siblings.indices[z-1]
+	}
+	return -1
+}
+
+func (r *Reader) trackSiblings(n *Node) {
+	s := &r.siblings
+	if s.counts == nil {
+		s.counts = []int{0}
+	}
+	s.closed = -1
+	switch n.Type {
+	case BeginElement:
+		z := len(s.counts) - 1
+		ix := s.counts[z]
+		s.counts[z]++
+		if n.SelfClosing {
+			s.closed = ix
+			break
+		}
+		s.indices = append(s.indices, ix)
+		s.counts = append(s.counts, 0)
+	case EndElement:
+		if z := len(s.indices); z > 0 {
+			s.closed = s.indices[z-1]
+			s.indices = s.indices[:z-1]
+			s.counts = s.counts[:len(s.counts)-1]
+		}
+	}
+}
+
+func (r *Reader) Done() bool {
+	return r.done
+}
+
+func (r *Reader) PathFqn() []string {
+	list := make([]string, len(r.stack))
+	for i := range r.stack {
+		list[i] = r.stack[i].Fqn()
+	}
+	return list
+}
+
+// PeekNode returns the next node without consuming it. The listeners are not
+// notified while peeking: their events are kept and fired by the Read call
+// that consumes the node. Until then, Locator and SiblingIndex already
+// report the peeked node.
+func (r *Reader) PeekNode() (*Node, error) {
+	if r.peeked != nil {
+		return r.peeked, nil
+	}
+	recording := r.listeners.recording
+	r.listeners.recording, r.listeners.peeking = true, true
+	n, err := r.Read()
+	r.listeners.recording, r.listeners.peeking = recording, false
+	if err != nil {
+		return n, err
+	}
+	if !r.replaying {
+		r.unwind(n)
+	}
+	r.peeked = n
+	return n, nil
+}
+
+func (r *Reader) Find(pred func(*Node) bool) (*Node, error) {
+	for {
+		n, err := r.Read()
+		if err != nil {
+			return nil, err
+		}
+		if pred(n) {
+			return n, nil
+		}
+	}
+}
+
+func (r *Reader) NextSibling() (*Node, error) {
+	for r.sibling > 0 && r.Depth() >= r.sibling {
+		if _, err := r.Read(); err != nil {
+			return nil, err
+		}
+	}
+	r.sibling = 0
+	depth := r.Depth()
+	for {
+		n, err := r.Read()
+		if err != nil {
+			return nil, err
+		}
+		if r.Depth() < depth {
+			return nil, io.EOF
+		}
+		if n.Type != BeginElement {
+			continue
+		}
+		if n.SelfClosing && r.Depth() == depth {
+			return n, nil
+		}
+		if !n.SelfClosing && r.Depth() == depth+1 {
+			r.sibling = r.Depth()
+			return n, nil
+		}
+	}
+}
+
+func (r *Reader) ReadInto(n *Node) error {
+	if r.peeked == nil {
+		r.into = n
+		defer func() {
+			r.into = nil
+		}()
+	}
+	m, err := r.Read()
+	if m != nil && m != n {
+		attrs := append(n.Attrs[:0], m.Attrs...)
+		*n = *m
+		n.Attrs = attrs
+	}
+	return err
+}
+
 func (r *Reader) Read() (*Node, error) {
+	if n := r.peeked; n != nil {
+		r.peeked = nil
+		if !r.replaying {
+			r.rewind(n)
+		}
+		return n, r.flushRecorded()
+	}
+	if r.preamble > 0 {
+		r.skipPreamble()
+	}
+	if r.maxNodes > 0 && r.count >= r.maxNodes {
+		return nil, ErrNodeLimit
+	}
+	if len(r.replay) > 0 {
+		return r.popReplay()
+	}
 	for {
-		n, err := r.next()
+		if err := r.checkTimeout(); err != nil {
+			return nil, err
+		}
+		if err := r.flushRecorded(); err != nil {
+			return nil, err
+		}
+		n, err := r.nextEvent()
 		if err != nil {
+			if errors.Is(err, io.EOF) {
+				if err := r.endText(); err != nil {
+					return nil, err
+				}
+				r.done = true
+				if r.mode == ModeStrict && !r.rooted {
+					err = fmt.Errorf("%w: no root element", ErrMalformed)
+				}
+			}
 			return nil, err
 		}
-		switch err = r.keep(n.Type, n.Name); {
+		if n.Type == ProcInst && !r.acceptTarget(n.Name) {
+			continue
+		}
+		if r.skipText(n) || (n.Type == Text && r.skipLeading && !r.rooted) {
+			continue
+		}
+		if !r.allowedType(n) {
+			return nil, fmt.Errorf("%w: %s not allowed", ErrMalformed, n.Type)
+		}
+		if n.Type == BeginElement && (r.skipElement || !r.allowedElement(n.Name)) {
+			r.skipElement = false
+			err = ErrIgnore
+		} else {
+			err = r.keep(n.Type, n.Name)
+		}
+		if err == nil && n.Type == ProcInst {
+			r.collectInstruction(n)
+		}
+		switch {
 		case errors.Is(err, ErrIgnore):
-			err := r.skipSubtree(n)
-			if err != nil {
+			if err := r.flushRecorded(); err != nil {
+				return nil, err
+			}
+			if err := r.skipSubtree(n); err != nil {
 				return nil, err
 			}
 		case errors.Is(err, ErrSkip):
+		case err == nil && r.postOrder:
+			return r.collectPostOrder(n)
 		default:
+			r.count++
+			r.replaying = false
 			return n, err
 		}
 	}
 }
 
+func (r *Reader) skipPreamble() {
+	for ; r.preamble > 0; r.preamble-- {
+		for {
+			c, err := r.read()
+			if err != nil || c == nl {
+				break
+			}
+			if c == cr {
+				if r.peek() == nl {
+					r.read()
+				}
+				break
+			}
+		}
+	}
+	r.skipBlanks()
+}
+
+func (r *Reader) checkTimeout() error {
+	if r.timeout <= 0 {
+		return nil
+	}
+	if r.started.IsZero() {
+		r.started = time.Now()
+	}
+	if time.Since(r.started) > r.timeout {
+		return ErrTimeout
+	}
+	return nil
+}
+
+func (r *Reader) skipText(n *Node) bool {
+	return n.Type == Text && n.Content == "" && r.trimMode() == TrimNewlines
+}
+
+func (r *Reader) acceptTarget(n Name) bool {
+	if r.targets == nil || n.Fqn() == "xml" {
+		return true
+	}
+	_, ok := r.targets[n.Fqn()]
+	return ok
+}
+
 func (r *Reader) skipSubtree(n *Node) error {
 	if n.Type != BeginElement || n.SelfClosing {
 		return nil
 	}
-	r.silent()
-	defer r.silent()
-	depth := r.Depth()
-	for {
-		c, err := r.next()
-		if err != nil {
+	var (
+		depth    = len(r.stack)
+		prefixes = r.scopePrefixes()
+		restore  = r.silent()
+	)
+	for len(r.stack) >= depth {
+		if _, err := r.nextEvent(); err != nil {
+			restore()
 			return err
 		}
-		if r.Depth() == depth && n.Name.Equal(c.Name) {
-			break
-		}
 	}
-	return nil
+	restore()
+	if !r.allowedElement(n.Name) {
+		return nil
+	}
+	if err := r.emitEnd(n.Name); err != nil {
+		return err
+	}
+	return r.emitNamespaceEnd(prefixes)
 }
 
 func (r *Reader) Run() error {
@@ -216,10 +874,18 @@ func (r *Reader) OnInstruction(fn func(Name) error) {
 	r.listeners.insts = append(r.listeners.insts, fn)
 }
 
+// OnAttribute registers fn to be called for each attribute of an element or
+// of a processing instruction. All the attribute events of an element fire
+// after its begin event and before any event of its children, including
+// when SetLazyAttrs is enabled.
 func (r *Reader) OnAttribute(fn func(Name, string) error) {
 	r.listeners.attrs = append(r.listeners.attrs, fn)
 }
 
+func (r *Reader) OnAttributeAt(fn func(Name, Name, string, int, int) error) {
+	r.listeners.attrsAt = append(r.listeners.attrsAt, fn)
+}
+
 func (r *Reader) OnText(fn func(string) error) {
 	r.listeners.texts = append(r.listeners.texts, fn)
 }
@@ -228,26 +894,104 @@ func (r *Reader) OnComment(fn func(string) error) {
 	r.listeners.comments = append(r.listeners.comments, fn)
 }
 
-func (r *Reader) silent() {
-	r.listeners.silent = !r.listeners.silent
+func (r *Reader) OnNamespace(fn func(string, string) error) {
+	r.listeners.nsBegins = append(r.listeners.nsBegins, fn)
+}
+
+func (r *Reader) OnNamespaceEnd(fn func(string) error) {
+	r.listeners.nsEnds = append(r.listeners.nsEnds, fn)
+}
+
+func (r *Reader) OnRawTag(fn func(string) error) {
+	r.listeners.rawTags = append(r.listeners.rawTags, fn)
+}
+
+func (r *Reader) OnTextStart(fn func() error) {
+	r.listeners.textStarts = append(r.listeners.textStarts, fn)
+}
+
+func (r *Reader) OnTextEnd(fn func() error) {
+	r.listeners.textEnds = append(r.listeners.textEnds, fn)
+}
+
+func (r *Reader) OnCDataStart(fn func() error) {
+	r.listeners.cdataStarts = append(r.listeners.cdataStarts, fn)
+}
+
+func (r *Reader) OnCDataEnd(fn func() error) {
+	r.listeners.cdataEnds = append(r.listeners.cdataEnds, fn)
+}
+
+func (r *Reader) OnDTDStart(fn func(string) error) {
+	r.listeners.dtdStarts = append(r.listeners.dtdStarts, fn)
+}
+
+func (r *Reader) OnDTDEnd(fn func() error) {
+	r.listeners.dtdEnds = append(r.listeners.dtdEnds, fn)
+}
+
+func (r *Reader) OnWarning(fn func(string) error) {
+	r.listeners.warnings = append(r.listeners.warnings, fn)
+}
+
+func (r *Reader) SetTracer(fn func(string, ...interface{})) {
+	r.tracer = fn
+}
+
+func (r *Reader) trace(event string, args ...interface{}) {
+	if r.tracer == nil {
+		return
+	}
+	r.tracer(event, args...)
+}
+
+func (r *Reader) silent() func() {
+	prev := r.listeners.silent
+	r.listeners.silent = true
+	return func() {
+		r.listeners.silent = prev
+	}
 }
 
 func (r *Reader) next() (*Node, error) {
+	if r.release {
+		r.release = false
+		r.popScope()
+	}
+	if len(r.queue) > 0 {
+		n := r.queue[0]
+		r.queue = r.queue[1:]
+		return r.closeElement(n)
+	}
+	if err := r.resume(); err != nil {
+		return nil, err
+	}
+	r.event = r.cursor()
+	r.startLayout()
+	if r.literalAngle() {
+		return r.layoutNode(r.parseText())
+	}
 	c, err := r.read()
 	if err != nil {
-		return nil, err
+		return r.layoutNode(nil, err)
 	}
 	if c == langle {
+		r.startCapture()
 		return r.parseNode()
 	}
+	if c == ampersand && r.splitEntities {
+		return r.layoutNode(r.parseEntityNode())
+	}
 	r.unread()
-	return r.parseText()
+	r.trace("text")
+	return r.layoutNode(r.parseText())
 }
 
 func (r *Reader) push(n *Node) {
 	if n.SelfClosing {
 		return
 	}
+	r.trace("push", n.Name)
 	r.stack = append(r.stack, n.Name)
 }
 
@@ -257,47 +1001,101 @@ func (r *Reader) pop(n *Node) error {
 		return fmt.Errorf("stack is empty")
 	}
 	pop := r.stack[z-1]
-	if !pop.Equal(n.Name) {
+	r.trace("pop", pop, n.Name)
+	if !r.matchOpen(pop, n.Name) {
 		return fmt.Errorf("%w: element mismatched %s vs %s", ErrMalformed, pop.Name, n.Name.Name)
 	}
 	r.stack = r.stack[:z-1]
 	return nil
 }
 
+func (r *Reader) newNode(t NodeType) *Node {
+	n := r.into
+	if n == nil {
+		return &Node{Type: t}
+	}
+	*n = Node{
+		Type:  t,
+		Attrs: n.Attrs[:0],
+		parts: n.parts[:0],
+	}
+	return n
+}
+
+func (r *Reader) unwind(n *Node) {
+	switch {
+	case n.Type == BeginElement && !n.SelfClosing:
+		r.stack = r.stack[:len(r.stack)-1]
+	case n.Type == EndElement:
+		r.stack = append(r.stack, n.Name)
+	}
+}
+
+func (r *Reader) rewind(n *Node) {
+	switch {
+	case n.Type == BeginElement:
+		r.push(n)
+	case n.Type == EndElement:
+		r.stack = r.stack[:len(r.stack)-1]
+	}
+}
+
 func (r *Reader) parseNode() (*Node, error) {
 	c, err := r.read()
 	if err != nil {
 		return nil, err
 	}
+	r.trace("dispatch", string(c))
 	var n *Node
 	switch {
 	case c == mark:
 		n, err = r.parseInstruction()
+		err = r.unterminated("processing instruction", err)
 	case c == bang:
-		c, err = r.read()
+		if c, err = r.read(); err != nil {
+			break
+		}
 		r.unread()
 		if c == lsquare {
 			n, err = r.parseData()
+			err = r.unterminated("CDATA", err)
 		} else if c == hyphen {
 			n, err = r.parseComment()
+			err = r.unterminated("comment", err)
+		} else if isLetter(c) {
+			n, err = r.parseDocType()
+		} else if r.mode == ModeLenient {
+			n, err = r.parseDeclaration()
 		} else {
 			err = r.unexpectedChar(c)
 		}
 	case c == slash:
 		n, err = r.parseEndElement()
 		if err == nil {
-			err = r.pop(n)
+			n, err = r.closeElement(n)
 		}
-	case isLetter(c):
+	case isNameStart(c):
 		r.unread()
 		n, err = r.parseOpenElement()
 		if err == nil {
+			r.rooted = true
 			r.push(n)
 		}
 	default:
 		err = r.unexpectedChar(c)
 	}
-	r.skipBlanks()
+	if raw, ok := r.stopCapture(); ok && err == nil {
+		r.attachLayout(n, raw)
+		if n == nil || n.Type != ProcInst || r.acceptTarget(n.Name) {
+			err = r.emitRawTag(raw)
+		}
+	}
+	if r.trimMode() == TrimAll {
+		r.skipTrailing()
+	}
+	if n == nil && err == nil {
+		return r.next()
+	}
 	return n, err
 }
 
@@ -306,11 +1104,10 @@ func (r *Reader) parseData() (*Node, error) {
 		return nil, err
 	}
 	var (
-		n   Node
+		n   = r.newNode(CData)
 		buf bytes.Buffer
 		err error
 	)
-	n.Type = CData
 	n.SelfClosing = true
 	if n.Name, err = r.parseName(); err != nil {
 		return nil, err
@@ -321,7 +1118,6 @@ func (r *Reader) parseData() (*Node, error) {
 	if err := r.want(lsquare); err != nil {
 		return nil, err
 	}
-	r.skipBlanks()
 	for {
 		c, err := r.read()
 		if err != nil {
@@ -329,33 +1125,106 @@ func (r *Reader) parseData() (*Node, error) {
 		}
 		if c == rsquare && r.peek() == c {
 			r.read()
-			if c, _ = r.read(); c == rangle {
+			if c, err = r.read(); err != nil {
+				return nil, err
+			}
+			if c == rangle {
 				break
 			}
 			return nil, fmt.Errorf("%w: ]] can not appear in CDATA sections", ErrMalformed)
 		}
-		buf.WriteRune(c)
+		if err := r.writeValid(&buf, c); err != nil {
+			return nil, err
+		}
 	}
-	n.Content = strings.TrimSpace(buf.String())
-	if err := r.emitText(n.Content); err != nil {
+	n.Content = buf.String()
+	if !r.preserveCData {
+		n.Content = r.trimText(n.Content)
+	}
+	if err := r.emitCData(n.Content); err != nil {
 		return nil, err
 	}
-	return &n, nil
+	return n, nil
 }
 
-func (r *Reader) parseComment() (*Node, error) {
-	if c, _ := r.read(); c == hyphen && r.peek() == c {
-		r.read()
-	} else {
-		return nil, r.unexpectedChar(c)
+func (r *Reader) parseDocType() (*Node, error) {
+	var (
+		n   = r.newNode(DocType)
+		err error
+	)
+	n.SelfClosing = true
+	if n.Name, err = r.parseName(); err != nil {
+		return nil, err
 	}
+	if n.Name.Name != "DOCTYPE" {
+		if r.mode == ModeLenient {
+			n.Type = Declaration
+			n.Content, err = r.scanMarkup()
+			return n, err
+		}
+		return nil, fmt.Errorf("%w: unexpected %s! want DOCTYPE", ErrMalformed, n.Name)
+	}
+	if n.Content, err = r.scanMarkup(); err != nil {
+		return nil, err
+	}
+	return n, r.emitDocType(n.Content)
+}
+
+func (r *Reader) parseDeclaration() (*Node, error) {
+	n := r.newNode(Declaration)
+	n.SelfClosing = true
+
+	var err error
+	n.Content, err = r.scanMarkup()
+	return n, err
+}
+
+func (r *Reader) scanMarkup() (string, error) {
 	r.skipBlanks()
 	var (
-		n   Node
+		buf   bytes.Buffer
+		quote rune
+		depth int
+	)
+	for {
+		c, err := r.read()
+		if err != nil {
+			return "", err
+		}
+		if quote == 0 && depth == 0 && c == rangle {
+			break
+		}
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case isQuote(c):
+			quote = c
+		case c == lsquare:
+			depth++
+		case c == rsquare:
+			depth--
+		}
+		buf.WriteRune(c)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+func (r *Reader) parseComment() (*Node, error) {
+	for i := 0; i < 2; i++ {
+		if err := r.want(hyphen); err != nil {
+			return nil, err
+		}
+	}
+	if !r.rawComments {
+		r.skipBlanks()
+	}
+	var (
+		n   = r.newNode(Comment)
 		buf bytes.Buffer
 	)
 	n.SelfClosing = true
-	n.Type = Comment
 	for {
 		c, err := r.read()
 		if err != nil {
@@ -363,120 +1232,325 @@ func (r *Reader) parseComment() (*Node, error) {
 		}
 		if c == hyphen && r.peek() == c {
 			r.read()
-			if c, _ = r.read(); c == rangle {
+			if c, err = r.read(); err != nil {
+				return nil, err
+			}
+			if c == rangle {
 				break
 			}
 			buf.WriteRune(hyphen)
 			buf.WriteRune(hyphen)
 		}
-		if c == ampersand {
-			c, err = r.parseEntity()
-			if err != nil {
+		if c == ampersand && !r.rawComments {
+			if _, err := r.writeEntity(&buf); err != nil {
 				return nil, err
 			}
+			continue
 		}
-		buf.WriteRune(c)
+		r.writeChar(&buf, c)
+	}
+	n.Content = buf.String()
+	if !r.rawComments {
+		n.Content = strings.TrimSpace(n.Content)
 	}
-	n.Content = strings.TrimSpace(buf.String())
 	if err := r.emitComment(n.Content); err != nil {
 		return nil, err
 	}
-	return &n, nil
+	return n, nil
 }
 
 func (r *Reader) parseText() (*Node, error) {
 	var (
-		n   Node
+		n   = r.newNode(Text)
 		buf bytes.Buffer
 	)
-	n.Type = Text
+	var last int
 	for {
+		literal := r.literalAngle()
 		c, err := r.read()
 		if err != nil {
 			return nil, err
 		}
-		if c == langle {
+		if (c == langle && !literal) || (c == ampersand && r.splitEntities) {
 			break
 		}
 		if c == ampersand {
-			c, err = r.parseEntity()
+			offset := buf.Len()
+			p, err := r.writeEntity(&buf)
 			if err != nil {
 				return nil, err
 			}
+			n.rawLen += len(p.Text)
+			n.expLen += utf8.RuneLen(p.Rune)
+			if r.raw {
+				n.parts = appendLiteral(n.parts, buf.String()[last:offset])
+				n.parts = append(n.parts, p)
+				last = buf.Len()
+			}
+			continue
 		}
-		buf.WriteRune(c)
+		n.rawLen += utf8.RuneLen(c)
+		n.expLen += utf8.RuneLen(c)
+		if err := r.writeValid(&buf, c); err != nil {
+			return nil, err
+		}
+	}
+	if r.leadingText() {
+		if r.raw {
+			n.parts = appendLiteral(n.parts, buf.String()[last:])
+		}
+		n.Content = buf.String()
+	} else {
+		if r.raw {
+			n.parts = trimParts(appendLiteral(n.parts, buf.String()[last:]), r.trimMode())
+		}
+		n.Content = r.trimText(buf.String())
+	}
+	if r.skipText(n) {
+		return n, r.unread()
+	}
+	if r.splitEntities && n.Content == "" && r.last == ampersand {
+		r.unread()
+		return r.next()
 	}
-	n.Content = strings.TrimSpace(buf.String())
 	if err := r.emitText(n.Content); err != nil {
 		return nil, err
 	}
-	return &n, r.unread()
+	return n, r.unread()
+}
+
+func (r *Reader) leadingText() bool {
+	return r.noSkip && r.event == Position{Line: 1, Column: 1}
+}
+
+func (r *Reader) parseEntityNode() (*Node, error) {
+	var buf bytes.Buffer
+	p, err := r.writeEntity(&buf)
+	if err != nil {
+		return nil, err
+	}
+	n := r.newNode(Entity)
+	n.SelfClosing = true
+	n.Name = Name{Name: strings.Trim(p.Text, "&;")}
+	n.Content = buf.String()
+	n.parts = append(n.parts, p)
+	return n, r.emitText(n.Content)
 }
 
 func (r *Reader) parseInstruction() (*Node, error) {
 	var (
-		n   Node
+		n   = r.newNode(ProcInst)
 		err error
 	)
 	n.SelfClosing = true
-	n.Type = ProcInst
 	if n.Name, err = r.parseName(); err != nil {
 		return nil, err
 	}
+	if !r.acceptTarget(n.Name) {
+		defer r.silent()()
+	}
 	if err := r.emitInst(n.Name); err != nil {
 		return nil, err
 	}
 	r.skipBlanks()
-	if err := r.parseAttributes(&n); err != nil {
+	if err := r.parseAttributes(n); err != nil {
+		return nil, err
+	}
+	if err := r.emitAttrs(n.Name, n.Attrs); err != nil {
 		return nil, err
 	}
+	if n.Fqn() == "xml" {
+		if r.mode == ModeStrict {
+			if err := validateDeclaration(n); err != nil {
+				return nil, err
+			}
+		}
+		if err := r.checkDeclaration(n); err != nil {
+			return nil, err
+		}
+	}
 	if err := r.want(mark); err != nil {
 		return nil, err
 	}
-	return &n, r.want(rangle)
+	return n, r.want(rangle)
 }
 
 func (r *Reader) parseEndElement() (*Node, error) {
 	var (
-		n   Node
+		n   = r.newNode(EndElement)
 		err error
 	)
-	n.Type = EndElement
 	if n.Name, err = r.parseName(); err != nil {
 		return nil, err
 	}
-	if err := r.emitEnd(n.Name); err != nil {
+	if n.Name, err = r.resolve(n.Name, false); err != nil {
 		return nil, err
 	}
 	r.skipBlanks()
-	return &n, r.want(rangle)
+	return n, r.want(rangle)
+}
+
+func (r *Reader) closeElement(n *Node) (*Node, error) {
+	if r.mode == ModeLenient {
+		switch ix := r.lookupOpen(n.Name); {
+		case ix < 0:
+			r.report.Dropped = append(r.report.Dropped, Recovery{Name: n.Name, Position: r.pos})
+			return nil, r.emitWarning(fmt.Sprintf("%s: stray </%s> dropped", r.pos, n.Name))
+		case ix < len(r.stack)-1:
+			top := r.stack[len(r.stack)-1]
+			r.report.AutoClosed = append(r.report.AutoClosed, Recovery{Name: top, Position: r.pos})
+			if err := r.emitWarning(fmt.Sprintf("%s: <%s> implicitly closed by </%s>", r.pos, top, n.Name)); err != nil {
+				return nil, err
+			}
+			q := *n
+			r.queue = append(r.queue, &q)
+			n = &Node{
+				Type: EndElement,
+				Name: top,
+			}
+		}
+	}
+	if err := r.pop(n); err != nil {
+		return nil, err
+	}
+	prefixes := r.scopePrefixes()
+	r.popScope()
+	if err := r.emitEnd(n.Name); err != nil {
+		return nil, err
+	}
+	return n, r.emitNamespaceEnd(prefixes)
+}
+
+func (r *Reader) lookupOpen(n Name) int {
+	for i := len(r.stack) - 1; i >= 0; i-- {
+		if r.matchOpen(r.stack[i], n) {
+			return i
+		}
+	}
+	return -1
 }
 
 func (r *Reader) parseOpenElement() (*Node, error) {
 	var (
-		n   Node
+		n   = r.newNode(BeginElement)
 		err error
 	)
-	n.Type = BeginElement
 	if n.Name, err = r.parseName(); err != nil {
 		return nil, err
 	}
-	if err := r.emitBegin(n.Name); err != nil {
+	if err := r.checkPattern(n.Name); err != nil {
 		return nil, err
 	}
 	r.skipBlanks()
-	if err := r.parseAttributes(&n); err != nil {
+	if r.deferAttrs() {
+		err = r.scanAttributes(n)
+	} else {
+		err = r.parseAttributes(n)
+		if err == nil {
+			err = r.closeTag(n)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := r.resolveElement(n); err != nil {
+		return nil, err
+	}
+	if err := r.checkSchema(n); err != nil {
+		return nil, err
+	}
+	if !r.allowedElement(n.Name) {
+		return n, nil
+	}
+	if err := r.emitNamespaces(); err != nil {
+		return nil, err
+	}
+	if err := r.emitBegin(n.Name); err != nil {
+		if !errors.Is(err, ErrSkipElement) {
+			return nil, err
+		}
+		r.skipElement = true
+	} else if err := r.emitAttrs(n.Name, n.Attrs); err != nil {
 		return nil, err
 	}
+	if n.SelfClosing {
+		return n, r.emitNamespaceEnd(r.scopePrefixes())
+	}
+	return n, nil
+}
+
+func (r *Reader) deferAttrs() bool {
+	if !r.lazyAttrs || r.nsmode != NSPrefix || r.filter != nil || r.schema != nil {
+		return false
+	}
+	if r.mode != ModeDefault || r.collapse || r.invalid.action != invalidAccept {
+		return false
+	}
+	if r.prefixMapper != nil || r.normalize != nil {
+		return false
+	}
+	return len(r.listeners.attrs) == 0 && len(r.listeners.attrsAt) == 0
+}
+
+func hasReservedAttrs(str string) bool {
+	return strings.Contains(str, xmlns) || strings.Contains(str, "xml:")
+}
+
+func (r *Reader) closeTag(n *Node) error {
 	c, err := r.read()
-	if err != nil || c == rangle {
-		return &n, err
+	if err != nil {
+		return err
 	}
-	if c != slash {
-		return nil, r.unexpectedChar(c)
+	switch c {
+	case rangle:
+	case slash:
+		n.SelfClosing = true
+		return r.want(rangle)
+	default:
+		return r.unexpectedChar(c)
+	}
+	return nil
+}
+
+func (r *Reader) scanAttributes(n *Node) error {
+	var (
+		buf   bytes.Buffer
+		quote rune
+		pos   = r.pos
+	)
+	for {
+		c, err := r.read()
+		if err != nil {
+			return err
+		}
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case isQuote(c):
+			quote = c
+		case c == slash && r.peek() == rangle:
+			r.read()
+			n.SelfClosing = true
+			fallthrough
+		case c == rangle:
+			if buf.Len() == 0 {
+				return nil
+			}
+			n.lazy = &lazyAttrs{
+				source: buf.String(),
+				raw:    r.raw,
+				pos:    pos,
+			}
+			if hasReservedAttrs(n.lazy.source) {
+				_, err := n.Attributes()
+				return err
+			}
+			return nil
+		}
+		buf.WriteRune(c)
 	}
-	n.SelfClosing = true
-	return &n, r.want(rangle)
 }
 
 func (r *Reader) parseName() (Name, error) {
@@ -485,8 +1559,8 @@ func (r *Reader) parseName() (Name, error) {
 		if err != nil {
 			return "", err
 		}
-		if !isLetter(c) {
-			return "", fmt.Errorf("%w: name should start with a letter!", r.unexpectedChar(c))
+		if !isNameStart(c) {
+			return "", fmt.Errorf("%w: name should start with a letter or underscore!", r.unexpectedChar(c))
 		}
 		var buf bytes.Buffer
 		buf.WriteRune(c)
@@ -511,44 +1585,79 @@ func (r *Reader) parseName() (Name, error) {
 	if c := r.peek(); c != colon {
 		return n, nil
 	}
-	n.NS, n.Name = n.Name, ""
 	r.read()
-	n.Name, err = parse()
+	local, err := parse()
+	if r.noNS {
+		n.Name = fmt.Sprintf("%s:%s", n.Name, local)
+	} else {
+		n.NS, n.Name = n.Name, local
+	}
 	return n, err
 }
 
-func (r *Reader) parseValue() (string, error) {
+func (r *Reader) parseValue(n *Node, a *Attr) error {
 	c, err := r.read()
 	if err != nil {
-		return "", err
+		return err
 	}
 	if !isQuote(c) {
-		return "", r.unexpectedChar(c)
+		return r.unexpectedChar(c)
 	}
 	var (
 		buf   bytes.Buffer
 		quote = c
+		last  int
 	)
 	for {
 		if c, err = r.read(); err != nil {
-			return "", err
+			return err
 		}
 		if c == quote {
 			break
 		}
+		if c == langle && r.mode == ModeStrict {
+			return fmt.Errorf("%w: < not allowed in attribute value", ErrMalformed)
+		}
+		if c == ampersand && r.mode == ModeLenient && !r.validReference() {
+			n.rawLen++
+			n.expLen++
+			buf.WriteRune(c)
+			continue
+		}
 		if c == ampersand {
-			c, err = r.parseEntity()
+			offset := buf.Len()
+			p, err := r.writeEntity(&buf)
 			if err != nil {
-				return "", err
+				return err
 			}
+			n.rawLen += len(p.Text)
+			n.expLen += utf8.RuneLen(p.Rune)
+			if r.raw {
+				a.parts = appendLiteral(a.parts, buf.String()[last:offset])
+				a.parts = append(a.parts, p)
+				last = buf.Len()
+			}
+			continue
+		}
+		n.rawLen += utf8.RuneLen(c)
+		n.expLen += utf8.RuneLen(c)
+		if err := r.writeValid(&buf, c); err != nil {
+			return err
 		}
-		buf.WriteRune(c)
 	}
-	return strings.TrimSpace(buf.String()), nil
+	if r.raw {
+		a.parts = trimParts(appendLiteral(a.parts, buf.String()[last:]), TrimAll)
+	}
+	if r.collapse {
+		a.Value = strings.Join(strings.Fields(buf.String()), " ")
+	} else {
+		a.Value = strings.TrimSpace(buf.String())
+	}
+	return nil
 }
 
 func (r *Reader) parseAttributes(n *Node) error {
-	seen := make(map[Name]struct{})
+	var seen map[Name]struct{}
 	for {
 		c, err := r.read()
 		if err != nil {
@@ -559,30 +1668,65 @@ func (r *Reader) parseAttributes(n *Node) error {
 		}
 		r.unread()
 		var a Attr
+		a.pos = r.cursor()
 		if a.Name, err = r.parseName(); err != nil {
 			return err
 		}
-		if _, ok := seen[a.Name]; ok {
-			return fmt.Errorf("%w: %s duplicated attribute", ErrMalformed, a.Name)
+		seen = trackAttrs(n.Attrs, seen)
+		if hasAttr(n.Attrs, seen, a.Name) {
+			return duplicatedAttr(a.Name)
+		}
+		if seen != nil {
+			seen[a.Name] = struct{}{}
 		}
-		seen[a.Name] = struct{}{}
 		r.skipBlanks()
 		if err := r.want(equal); err != nil {
 			return err
 		}
 		r.skipBlanks()
-		if a.Value, err = r.parseValue(); err != nil {
+		if err = r.parseValue(n, &a); err != nil {
 			return err
 		}
-		n.Attrs = append(n.Attrs, a)
-		if err := r.emitAttr(a.Name, a.Value); err != nil {
-			return err
+		if n.Attrs == nil {
+			n.Attrs = make([]Attr, 0, attrPresize)
 		}
+		n.Attrs = append(n.Attrs, a)
 		r.skipBlanks()
 	}
 	return r.unread()
 }
 
+func trackAttrs(attrs []Attr, seen map[Name]struct{}) map[Name]struct{} {
+	if seen != nil || len(attrs) < attrScanLimit {
+		return seen
+	}
+	seen = make(map[Name]struct{}, len(attrs)*2)
+	for _, a := range attrs {
+		seen[a.Name] = struct{}{}
+	}
+	return seen
+}
+
+func hasAttr(attrs []Attr, seen map[Name]struct{}, name Name) bool {
+	if seen != nil {
+		_, ok := seen[name]
+		return ok
+	}
+	for _, a := range attrs {
+		if a.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func duplicatedAttr(name Name) error {
+	if isNamespaceDecl(name) {
+		return duplicatedNamespace(name)
+	}
+	return fmt.Errorf("%w: %s duplicated attribute", ErrMalformed, name)
+}
+
 var entities = map[string]rune{
 	"quot": dquote,
 	"apos": squote,
@@ -597,78 +1741,127 @@ const (
 )
 
 func (r *Reader) parseEntity() (rune, error) {
+	p, err := r.parseReference()
+	return p.Rune, err
+}
+
+func (r *Reader) writeEntity(buf *bytes.Buffer) (ContentPart, error) {
+	p, err := r.parseReference()
+	if err != nil {
+		return p, err
+	}
+	r.trace("entity", p.Text)
+	if r.raw {
+		buf.WriteString(p.Text)
+	} else {
+		buf.WriteRune(p.Rune)
+	}
+	return p, nil
+}
+
+func (r *Reader) parseReference() (ContentPart, error) {
 	c, err := r.read()
 	if err != nil {
-		return 0, err
+		return ContentPart{}, err
 	}
 	if c == pound {
 		c, err = r.read()
 		if err != nil {
-			return 0, err
+			return ContentPart{}, err
 		}
 		var (
 			accept = isDigit
 			base   = baseDec
+			marker string
 		)
-		if c == 'x' {
+		if c == 'x' || (c == 'X' && r.mode != ModeStrict) {
 			accept = isHex
 			base = baseHex
+			marker = string(c)
+		} else {
+			r.unread()
 		}
-		return r.parseNumericEntity(base, accept)
+		return r.parseNumericEntity(marker, base, accept)
 	}
 	return r.parseStringEntity()
 }
 
-func (r *Reader) parseStringEntity() (rune, error) {
+func (r *Reader) parseStringEntity() (ContentPart, error) {
 	r.unread()
 
-	var buf bytes.Buffer
-	for {
-		c, err := r.read()
-		if err != nil {
-			return 0, err
-		}
-		if c == semicolon {
-			break
-		}
-		if !isLetter(c) {
-			return 0, r.unexpectedChar(c)
-		}
-		buf.WriteRune(c)
+	part := ContentPart{Type: EntityPart}
+	str, err := r.readReference(isLetter)
+	if err != nil {
+		return part, err
 	}
-	c, ok := entities[buf.String()]
+	part.Name = str
+	part.Text = fmt.Sprintf("&%s;", str)
+	c, ok := entities[str]
 	if !ok {
-		return 0, fmt.Errorf("%w: %s unknown entity", ErrMalformed, buf.String())
+		return part, fmt.Errorf("%w: %s unknown entity", ErrMalformed, str)
+	}
+	part.Rune = c
+	return part, nil
+}
+
+func (r *Reader) parseNumericEntity(marker string, base int, accept func(rune) bool) (ContentPart, error) {
+	part := ContentPart{Type: CharRefPart}
+	str, err := r.readReference(accept)
+	if err != nil {
+		return part, err
 	}
-	return c, nil
+	part.Text = fmt.Sprintf("&#%s%s;", marker, str)
+	n, err := strconv.ParseInt(str, base, 32)
+	part.Rune = rune(n)
+	return part, err
 }
 
-func (r *Reader) parseNumericEntity(base int, accept func(rune) bool) (rune, error) {
+func (r *Reader) readReference(accept func(rune) bool) (string, error) {
 	var buf bytes.Buffer
 	for {
 		c, err := r.read()
 		if err != nil {
-			return 0, err
+			return "", err
 		}
 		if c == semicolon {
 			break
 		}
 		if !accept(c) {
-			return 0, r.unexpectedChar(c)
+			return "", r.unexpectedChar(c)
 		}
 		buf.WriteRune(c)
 	}
-	n, err := strconv.ParseInt(buf.String(), base, 32)
-	return rune(n), err
+	return buf.String(), nil
 }
 
 func (r *Reader) skipBlanks() {
-	defer r.unread()
+	var buf *bytes.Buffer
+	if r.layout && !r.capturing {
+		buf = &r.blanks
+	}
+	r.skipBlanksInto(buf)
+}
+
+func (r *Reader) skipTrailing() {
+	r.trailing = true
+	r.skipBlanks()
+	r.trailing = false
+}
+
+func (r *Reader) skipBlanksInto(buf *bytes.Buffer) {
+	r.skipping = true
+	defer func() {
+		r.skipping = false
+		r.unread()
+	}()
 	for {
 		c, err := r.read()
 		if err != nil || !isBlank(c) {
 			break
 		}
+		if buf != nil {
+			buf.WriteRune(c)
+		}
 	}
 }
 
@@ -693,6 +1886,12 @@ func (r *Reader) emitBegin(n Name) error {
 	if r.listeners.silent {
 		return err
 	}
+	if r.listeners.recording {
+		return r.record(func() error { return r.emitBegin(n) })
+	}
+	if err := r.endText(); err != nil {
+		return err
+	}
 	r.listeners.begins, err = r.emitNode(n, r.listeners.begins)
 	return err
 }
@@ -702,6 +1901,12 @@ func (r *Reader) emitEnd(n Name) error {
 	if r.listeners.silent {
 		return err
 	}
+	if r.listeners.recording {
+		return r.record(func() error { return r.emitEnd(n) })
+	}
+	if err := r.endText(); err != nil {
+		return err
+	}
 	r.listeners.ends, err = r.emitNode(n, r.listeners.ends)
 	return err
 }
@@ -711,6 +1916,12 @@ func (r *Reader) emitInst(n Name) error {
 	if r.listeners.silent {
 		return err
 	}
+	if r.listeners.recording {
+		return r.record(func() error { return r.emitInst(n) })
+	}
+	if err := r.endText(); err != nil {
+		return err
+	}
 	r.listeners.insts, err = r.emitNode(n, r.listeners.insts)
 	return err
 }
@@ -720,23 +1931,210 @@ func (r *Reader) emitText(str string) error {
 	if r.listeners.silent {
 		return err
 	}
+	if r.listeners.recording {
+		return r.record(func() error { return r.emitText(str) })
+	}
+	if str != "" {
+		if err := r.startText(); err != nil {
+			return err
+		}
+	}
 	r.listeners.texts, err = r.emitString(str, r.listeners.texts)
 	return err
 }
 
+func (r *Reader) startText() error {
+	var err error
+	if r.inText {
+		return err
+	}
+	r.inText = true
+	r.listeners.textStarts, err = r.emitEvent(r.listeners.textStarts)
+	return err
+}
+
+func (r *Reader) endText() error {
+	var err error
+	if !r.inText {
+		return err
+	}
+	r.inText = false
+	r.listeners.textEnds, err = r.emitEvent(r.listeners.textEnds)
+	return err
+}
+
+func (r *Reader) emitCData(str string) error {
+	var err error
+	if r.listeners.silent {
+		return err
+	}
+	if r.listeners.recording {
+		return r.record(func() error { return r.emitCData(str) })
+	}
+	if err := r.startText(); err != nil {
+		return err
+	}
+	if r.listeners.cdataStarts, err = r.emitEvent(r.listeners.cdataStarts); err != nil {
+		return err
+	}
+	if err := r.emitText(str); err != nil {
+		return err
+	}
+	r.listeners.cdataEnds, err = r.emitEvent(r.listeners.cdataEnds)
+	return err
+}
+
+func (r *Reader) emitDocType(str string) error {
+	var err error
+	if r.listeners.silent {
+		return err
+	}
+	if r.listeners.recording {
+		return r.record(func() error { return r.emitDocType(str) })
+	}
+	if err := r.endText(); err != nil {
+		return err
+	}
+	var root string
+	if fields := strings.Fields(str); len(fields) > 0 {
+		root = fields[0]
+	}
+	if r.listeners.dtdStarts, err = r.emitString(root, r.listeners.dtdStarts); err != nil {
+		return err
+	}
+	r.listeners.dtdEnds, err = r.emitEvent(r.listeners.dtdEnds)
+	return err
+}
+
 func (r *Reader) emitComment(str string) error {
 	var err error
 	if r.listeners.silent {
 		return err
 	}
+	if r.listeners.recording {
+		return r.record(func() error { return r.emitComment(str) })
+	}
+	if err := r.endText(); err != nil {
+		return err
+	}
 	r.listeners.comments, err = r.emitString(str, r.listeners.comments)
 	return err
 }
 
+func (r *Reader) emitNamespaces() error {
+	if r.listeners.silent || len(r.scopes) == 0 {
+		return nil
+	}
+	return r.emitScope(r.scopes[len(r.scopes)-1])
+}
+
+func (r *Reader) emitScope(curr scope) error {
+	if r.listeners.recording {
+		return r.record(func() error { return r.emitScope(curr) })
+	}
+	for _, prefix := range curr.prefixes {
+		for i := 0; i < len(r.listeners.nsBegins); i++ {
+			fn := r.listeners.nsBegins[i]
+			if err := fn(prefix, curr.ns[prefix]); err != nil {
+				if errors.Is(err, ErrUnsubscribe) {
+					r.listeners.nsBegins = append(r.listeners.nsBegins[:i], r.listeners.nsBegins[i+1:]...)
+					i--
+					continue
+				}
+				if r.collectError(err) {
+					continue
+				}
+				return checkListenerError(err)
+			}
+		}
+	}
+	return nil
+}
+
+func (r *Reader) emitNamespaceEnd(prefixes []string) error {
+	if r.listeners.silent {
+		return nil
+	}
+	if r.listeners.recording {
+		return r.record(func() error { return r.emitNamespaceEnd(prefixes) })
+	}
+	for _, prefix := range prefixes {
+		var err error
+		r.listeners.nsEnds, err = r.emitString(prefix, r.listeners.nsEnds)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Reader) emitRawTag(str string) error {
+	var err error
+	if r.listeners.silent {
+		return err
+	}
+	if r.listeners.recording {
+		return r.record(func() error { return r.emitRawTag(str) })
+	}
+	r.listeners.rawTags, err = r.emitString(str, r.listeners.rawTags)
+	return err
+}
+
+func (r *Reader) emitWarning(str string) error {
+	var err error
+	if r.listeners.silent {
+		return err
+	}
+	if r.listeners.recording {
+		return r.record(func() error { return r.emitWarning(str) })
+	}
+	r.listeners.warnings, err = r.emitString(str, r.listeners.warnings)
+	return err
+}
+
+func (r *Reader) emitAttrs(owner Name, attrs []Attr) error {
+	for _, a := range attrs {
+		if err := r.emitAttr(a.Name, a.Value); err != nil {
+			return err
+		}
+		if err := r.emitAttrAt(owner, a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Reader) emitAttrAt(owner Name, a Attr) error {
+	if r.listeners.silent {
+		return nil
+	}
+	if r.listeners.recording {
+		return r.record(func() error { return r.emitAttrAt(owner, a) })
+	}
+	for i := 0; i < len(r.listeners.attrsAt); i++ {
+		fn := r.listeners.attrsAt[i]
+		if err := fn(owner, a.Name, a.Value, a.pos.Line, a.pos.Column); err != nil {
+			if errors.Is(err, ErrUnsubscribe) {
+				r.listeners.attrsAt = append(r.listeners.attrsAt[:i], r.listeners.attrsAt[i+1:]...)
+				i--
+				continue
+			}
+			if r.collectError(err) {
+				continue
+			}
+			return checkListenerError(err)
+		}
+	}
+	return nil
+}
+
 func (r *Reader) emitAttr(n Name, str string) error {
 	if r.listeners.silent {
 		return nil
 	}
+	if r.listeners.recording {
+		return r.record(func() error { return r.emitAttr(n, str) })
+	}
 	for i := 0; i < len(r.listeners.attrs); i++ {
 		fn := r.listeners.attrs[i]
 		if err := fn(n, str); err != nil {
@@ -745,6 +2143,9 @@ func (r *Reader) emitAttr(n Name, str string) error {
 				i--
 				continue
 			}
+			if r.collectError(err) {
+				continue
+			}
 			return checkListenerError(err)
 		}
 	}
@@ -760,6 +2161,27 @@ func (r *Reader) emitString(str string, set []func(string) error) ([]func(string
 				i--
 				continue
 			}
+			if r.collectError(err) {
+				continue
+			}
+			return set, checkListenerError(err)
+		}
+	}
+	return set, nil
+}
+
+func (r *Reader) emitEvent(set []func() error) ([]func() error, error) {
+	for i := 0; i < len(set); i++ {
+		fn := set[i]
+		if err := fn(); err != nil {
+			if errors.Is(err, ErrUnsubscribe) {
+				set = append(set[:i], set[i+1:]...)
+				i--
+				continue
+			}
+			if r.collectError(err) {
+				continue
+			}
 			return set, checkListenerError(err)
 		}
 	}
@@ -775,6 +2197,9 @@ func (r *Reader) emitNode(n Name, set []func(Name) error) ([]func(Name) error, e
 				i--
 				continue
 			}
+			if r.collectError(err) {
+				continue
+			}
 			return set, checkListenerError(err)
 		}
 	}
@@ -782,12 +2207,137 @@ func (r *Reader) emitNode(n Name, set []func(Name) error) ([]func(Name) error, e
 }
 
 func (r *Reader) read() (rune, error) {
-	c, _, err := r.rs.ReadRune()
+	c, z, err := r.rs.ReadRune()
+	for errors.Is(err, io.EOF) && r.follow && !r.skipping {
+		if err = r.wait(); err != nil {
+			return c, err
+		}
+		c, z, err = r.rs.ReadRune()
+	}
+	if err != nil {
+		return c, err
+	}
+	r.prevPos, r.prevLast = r.pos, r.last
+	r.offset += int64(z)
+	r.lastSize = z
+	if r.capturing {
+		r.capture.WriteRune(c)
+	}
+	if r.marking {
+		r.marked.WriteRune(c)
+	}
+	r.detectLineEnding(c)
+	switch {
+	case c == nl && r.last == cr:
+	case isNL(c):
+		r.pos.Line++
+		r.pos.Column = 0
+	default:
+		r.pos.Column++
+	}
+	r.last = c
 	return c, err
 }
 
 func (r *Reader) unread() error {
-	return r.rs.UnreadRune()
+	err := r.rs.UnreadRune()
+	if err == nil {
+		if r.capturing {
+			r.capture.Truncate(r.capture.Len() - utf8.RuneLen(r.last))
+		}
+		if r.marking {
+			r.marked.Truncate(r.marked.Len() - utf8.RuneLen(r.last))
+		}
+		r.offset -= int64(r.lastSize)
+		r.pos, r.last = r.prevPos, r.prevLast
+	}
+	return err
+}
+
+func (r *Reader) startCapture() {
+	if r.capturing || len(r.listeners.rawTags) == 0 {
+		return
+	}
+	r.capturing = true
+	r.capture.Reset()
+	r.capture.WriteRune(langle)
+}
+
+func (r *Reader) stopCapture() (string, bool) {
+	if !r.capturing {
+		return "", false
+	}
+	r.capturing = false
+	return r.capture.String(), true
+}
+
+func (r *Reader) detectLineEnding(c rune) {
+	if r.pending {
+		r.pending = false
+		if c == nl {
+			r.eol = "\r\n"
+		}
+	}
+	if r.eol != "" {
+		return
+	}
+	switch c {
+	case nl:
+		r.eol = "\n"
+	case cr:
+		r.eol, r.pending = "\r", true
+	}
+}
+
+func (r *Reader) writeChar(buf *bytes.Buffer, c rune) {
+	switch {
+	case c == cr:
+		buf.WriteRune(nl)
+	case c == nl && r.prevLast == cr:
+	default:
+		buf.WriteRune(c)
+	}
+}
+
+func (r *Reader) cursor() Position {
+	pos := r.pos
+	pos.Column++
+	return pos
+}
+
+func (r *Reader) validReference() bool {
+	b, _ := r.rs.Peek(maxReference)
+	ix := bytes.IndexByte(b, semicolon)
+	if ix <= 0 {
+		return false
+	}
+	ref := string(b[:ix])
+	switch {
+	case strings.HasPrefix(ref, "#x") || (strings.HasPrefix(ref, "#X") && r.mode != ModeStrict):
+		return validDigits(ref[2:], isHex)
+	case strings.HasPrefix(ref, "#"):
+		return validDigits(ref[1:], isDigit)
+	default:
+		_, ok := entities[ref]
+		return ok
+	}
+}
+
+func validDigits(str string, accept func(rune) bool) bool {
+	for _, c := range str {
+		if !accept(c) {
+			return false
+		}
+	}
+	return str != ""
+}
+
+func (r *Reader) literalAngle() bool {
+	if r.mode != ModeLenient {
+		return false
+	}
+	b, _ := r.rs.Peek(2)
+	return len(b) == 2 && b[0] == langle && isBlank(rune(b[1]))
 }
 
 func (r *Reader) peek() rune {
@@ -796,10 +2346,44 @@ func (r *Reader) peek() rune {
 	return c
 }
 
+func (r *Reader) SetRejectUnterminated(reject bool) {
+	r.rejectEOF = reject
+}
+
+func (r *Reader) unterminated(what string, err error) error {
+	if !r.rejectEOF || !errors.Is(err, io.EOF) {
+		return err
+	}
+	return fmt.Errorf("%w: %s: unterminated %s", ErrMalformed, r.event, what)
+}
+
 func (r *Reader) unexpectedChar(c rune) error {
 	return fmt.Errorf("%c: %w", c, ErrChar)
 }
 
+type ListenerErrorPolicy int
+
+const (
+	AbortOnError ListenerErrorPolicy = iota
+	ContinueOnError
+)
+
+func (r *Reader) SetListenerErrorPolicy(policy ListenerErrorPolicy) {
+	r.errPolicy = policy
+}
+
+func (r *Reader) ListenerErrors() []error {
+	return r.errs
+}
+
+func (r *Reader) collectError(err error) bool {
+	if r.errPolicy != ContinueOnError || errors.Is(err, ErrStop) || errors.Is(err, ErrSkipElement) {
+		return false
+	}
+	r.errs = append(r.errs, err)
+	return true
+}
+
 func checkListenerError(err error) error {
 	if errors.Is(err, ErrStop) {
 		return nil
@@ -807,8 +2391,12 @@ func checkListenerError(err error) error {
 	return err
 }
 
+func isNameStart(r rune) bool {
+	return isLetter(r) || r == underscore
+}
+
 func isName(r rune) bool {
-	return isLetter(r) || isDigit(r) || r == hyphen || r == underscore
+	return isLetter(r) || isDigit(r) || r == hyphen || r == underscore || r == dot
 }
 
 func isLetter(r rune) bool {
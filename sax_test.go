@@ -0,0 +1,1603 @@
+package sax
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+const sample = `
+<?xml version="1.0" encoding="UTF-8"?>
+<!-- this is a -- comment -->
+<root xmlns:sax="http://localhost">
+  <sax:DocumentElement sax:param="value">
+    <First-Element>
+      &#x21; Some Text
+    </First-Element>
+    <?some_pi some_attr="some_value"?>
+    <SecondElement param2="something">
+      Pre-Text <Inline>Inlined text</Inline> Post-text.
+    </SecondElement>
+    <script>
+      <![CDATA[
+        <message>Welcome</message>
+      ]]>
+    </script>
+  </sax:DocumentElement>
+</root>
+`
+
+func readAll(r *Reader) ([]*Node, error) {
+	var nodes []*Node
+	for {
+		n, err := r.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+			return nodes, err
+		}
+		nodes = append(nodes, n)
+	}
+}
+
+func TestLazyAttrsNamespaces(t *testing.T) {
+	const doc = `<r xmlns:p="urn:p"><p:a xmlns:q="urn:q" q:x="1"><q:b/></p:a></r>`
+	r := New(strings.NewReader(doc), nil)
+	r.SetLazyAttrs(true)
+	var prefixes []string
+	r.OnNamespace(func(prefix, uri string) error {
+		prefixes = append(prefixes, prefix)
+		return nil
+	})
+	if _, err := readAll(r); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if strings.Join(prefixes, ",") != "p,q" {
+		t.Errorf("namespaces not reported: %v", prefixes)
+	}
+}
+
+func TestLazyAttrsSettings(t *testing.T) {
+	const doc = `<r x="a<b" y="  p   q  "/>`
+	r := New(strings.NewReader(doc), nil)
+	r.SetMode(ModeStrict)
+	r.SetLazyAttrs(true)
+	if _, err := readAll(r); !errors.Is(err, ErrMalformed) {
+		t.Errorf("strict mode should reject < in lazy attributes: %v", err)
+	}
+
+	r = New(strings.NewReader(`<r y="  p   q  "/>`), nil)
+	r.SetLazyAttrs(true)
+	r.SetCollapseAttrWhitespace(true)
+	nodes, err := readAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	attrs, err := nodes[0].Attributes()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(attrs) != 1 || attrs[0].Value != "p q" {
+		t.Errorf("attribute value not collapsed: %v", attrs)
+	}
+}
+
+func TestLazyAttrsPosition(t *testing.T) {
+	r := New(strings.NewReader("<r>\n  <a x=\"1\" y=\"2\"/></r>"), nil)
+	r.SetLazyAttrs(true)
+	nodes, err := readAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	attrs, err := nodes[1].Attributes()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if pos := attrs[1].pos; pos.Line != 2 || pos.Column != 12 {
+		t.Errorf("unexpected attribute position: %s", pos)
+	}
+}
+
+func recordEvents(r *Reader) *[]string {
+	var events []string
+	r.OnBeginElement(func(n Name) error {
+		events = append(events, "<"+n.Fqn())
+		return nil
+	})
+	r.OnEndElement(func(n Name) error {
+		events = append(events, "/"+n.Fqn())
+		return nil
+	})
+	r.OnNamespace(func(prefix, _ string) error {
+		events = append(events, "+"+prefix)
+		return nil
+	})
+	r.OnNamespaceEnd(func(prefix string) error {
+		events = append(events, "-"+prefix)
+		return nil
+	})
+	return &events
+}
+
+func TestSkipElementBalanced(t *testing.T) {
+	const doc = `<r><skip xmlns:p="urn:p"><p:a/><b>text</b></skip><keep/></r>`
+	r := New(strings.NewReader(doc), nil)
+	events := recordEvents(r)
+	r.OnBeginElement(func(n Name) error {
+		if n.Name == "skip" {
+			return ErrSkipElement
+		}
+		return nil
+	})
+	if err := r.Run(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := "<r +p <skip /skip -p <keep /r"
+	if got := strings.Join(*events, " "); got != want {
+		t.Errorf("unbalanced events: want %q, got %q", want, got)
+	}
+}
+
+func TestSchemaDropBalanced(t *testing.T) {
+	const doc = `<r><bad xmlns:p="urn:p"><p:a/></bad><ok/></r>`
+	r := New(strings.NewReader(doc), nil)
+	r.SetMode(ModeLenient)
+	r.SetSchema(map[string][]string{
+		"r":  nil,
+		"ok": nil,
+	})
+	events := recordEvents(r)
+	if err := r.Run(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := "<r <ok /r"
+	if got := strings.Join(*events, " "); got != want {
+		t.Errorf("unbalanced events: want %q, got %q", want, got)
+	}
+}
+
+func readFirst(t *testing.T, doc string, setup func(*Reader)) *Node {
+	t.Helper()
+	r := New(strings.NewReader(doc), nil)
+	if setup != nil {
+		setup(r)
+	}
+	n, err := r.Read()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return n
+}
+
+func TestAttrSameLocalName(t *testing.T) {
+	const doc = `<a xmlns:n1="urn:1" xmlns:n2="urn:2" n1:x="1" n2:x="2"/>`
+	modes := []NamespaceMode{NSPrefix, NSResolvedURI, NSCanonical}
+	for _, mode := range modes {
+		n := readFirst(t, doc, func(r *Reader) {
+			r.SetNamespaceMode(mode)
+		})
+		var values []string
+		for _, a := range n.Attrs {
+			if a.Name.Name == "x" {
+				values = append(values, a.Value)
+			}
+		}
+		if strings.Join(values, ",") != "1,2" {
+			t.Errorf("mode %d: both attributes should be kept: %v", mode, n.Attrs)
+		}
+	}
+}
+
+func TestStartTagWhitespace(t *testing.T) {
+	n := readFirst(t, "<a\n\tx\n=\n\"1\"\n\ty\t=\t'2'\r\n/>", nil)
+	if !n.SelfClosing {
+		t.Errorf("element should be self closing")
+	}
+	if len(n.Attrs) != 2 || n.Attrs[0].Value != "1" || n.Attrs[1].Value != "2" {
+		t.Errorf("unexpected attributes: %v", n.Attrs)
+	}
+	n = readFirst(t, "<a \t x = \"1\" \n >", nil)
+	if n.SelfClosing || len(n.Attrs) != 1 || n.Attrs[0].Value != "1" {
+		t.Errorf("unexpected element: %v", n.Attrs)
+	}
+}
+
+func TestAttrQuotes(t *testing.T) {
+	tests := []struct {
+		Input string
+		Want  string
+	}{
+		{Input: `<a x="a'b"/>`, Want: `a'b`},
+		{Input: `<a x='a"b'/>`, Want: `a"b`},
+		{Input: `<a x="a &quot; b"/>`, Want: `a " b`},
+		{Input: `<a x='a &apos; b'/>`, Want: `a ' b`},
+		{Input: `<a x="it's &amp; more"/>`, Want: `it's & more`},
+	}
+	for _, tt := range tests {
+		n := readFirst(t, tt.Input, nil)
+		if len(n.Attrs) != 1 || n.Attrs[0].Value != tt.Want {
+			t.Errorf("%s: want %q, got %v", tt.Input, tt.Want, n.Attrs)
+		}
+	}
+}
+
+func TestAttrMultiline(t *testing.T) {
+	const doc = "<a title=\"first line\n  second line\"/>"
+	n := readFirst(t, doc, nil)
+	if want := "first line\n  second line"; len(n.Attrs) != 1 || n.Attrs[0].Value != want {
+		t.Errorf("want %q, got %q", want, n.Attrs[0].Value)
+	}
+	n = readFirst(t, doc, func(r *Reader) {
+		r.SetCollapseAttrWhitespace(true)
+	})
+	if want := "first line second line"; len(n.Attrs) != 1 || n.Attrs[0].Value != want {
+		t.Errorf("collapsed: want %q, got %q", want, n.Attrs[0].Value)
+	}
+}
+
+const benchDoc = `<?xml version="1.0" encoding="UTF-8"?>
+<!-- catalog -->
+<catalog xmlns:x="urn:x">
+  <book id="1" x:lang="en"><title>First &amp; foremost</title><![CDATA[<raw>]]></book>
+  <book id="2" x:lang="fr"><title>Second</title><?pi a="b"?></book>
+</catalog>`
+
+func TestReadInto(t *testing.T) {
+	var want []string
+	nodes, err := readAll(New(strings.NewReader(benchDoc), nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, n := range nodes {
+		want = append(want, fmt.Sprintf("%s %s %v %q %t", n.Type, n.Name, n.Attrs, n.Content, n.SelfClosing))
+	}
+	var (
+		r    = New(strings.NewReader(benchDoc), nil)
+		node Node
+	)
+	for i := 0; ; i++ {
+		err := r.ReadInto(&node)
+		if errors.Is(err, io.EOF) {
+			if i != len(want) {
+				t.Errorf("want %d nodes, got %d", len(want), i)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		got := fmt.Sprintf("%s %s %v %q %t", node.Type, node.Name, node.Attrs, node.Content, node.SelfClosing)
+		if i >= len(want) || got != want[i] {
+			t.Errorf("node %d: got %s", i, got)
+		}
+	}
+}
+
+func BenchmarkRead(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r := New(strings.NewReader(benchDoc), nil)
+		for {
+			if _, err := r.Read(); err != nil {
+				break
+			}
+		}
+	}
+}
+
+func BenchmarkReadInto(b *testing.B) {
+	b.ReportAllocs()
+	var node Node
+	for i := 0; i < b.N; i++ {
+		r := New(strings.NewReader(benchDoc), nil)
+		for {
+			if err := r.ReadInto(&node); err != nil {
+				break
+			}
+		}
+	}
+}
+
+func benchmarkAttrs(b *testing.B, count int) {
+	var str strings.Builder
+	str.WriteString("<root")
+	for i := 0; i < count; i++ {
+		fmt.Fprintf(&str, ` attr%d="value%d"`, i, i)
+	}
+	str.WriteString("/>")
+	doc := str.String()
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(doc)))
+	for i := 0; i < b.N; i++ {
+		r := New(strings.NewReader(doc), nil)
+		if _, err := r.Read(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAttrs0(b *testing.B) {
+	benchmarkAttrs(b, 0)
+}
+
+func BenchmarkAttrs4(b *testing.B) {
+	benchmarkAttrs(b, 4)
+}
+
+func BenchmarkAttrs1000(b *testing.B) {
+	benchmarkAttrs(b, 1000)
+}
+
+func TestNoInitialSkip(t *testing.T) {
+	const doc = "  \n\t<root> a </root>"
+	r := New(strings.NewReader(doc), nil, WithNoInitialSkip())
+	nodes, err := readAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(nodes) == 0 || nodes[0].Type != Text {
+		t.Fatalf("leading whitespace not reported as text node")
+	}
+	if got := nodes[0].Content; got != "  \n\t" {
+		t.Errorf("leading whitespace mismatched: want %q, got %q", "  \n\t", got)
+	}
+	for _, n := range nodes[1:] {
+		if n.Type == Text && n.Content != "a" {
+			t.Errorf("text not trimmed: got %q", n.Content)
+		}
+	}
+}
+
+func TestDone(t *testing.T) {
+	tests := []struct {
+		Doc  string
+		Post bool
+	}{
+		{Doc: "<root><a/>text</root>\n<!-- trailing -->\n  "},
+		{Doc: "<root/>  "},
+		{Doc: "<a/><b/>"},
+		{Doc: "<root><a><b/></a></root>", Post: true},
+	}
+	for _, tt := range tests {
+		r := New(strings.NewReader(tt.Doc), nil)
+		r.SetPostOrder(tt.Post)
+		for {
+			if r.Done() {
+				t.Fatalf("%q: done before the last node", tt.Doc)
+			}
+			if _, err := r.PeekNode(); errors.Is(err, io.EOF) {
+				break
+			}
+			if r.Done() {
+				t.Fatalf("%q: done after peeking", tt.Doc)
+			}
+			if _, err := r.Read(); err != nil {
+				t.Fatalf("%q: unexpected error: %s", tt.Doc, err)
+			}
+		}
+		if !r.Done() {
+			t.Errorf("%q: not done after the last node", tt.Doc)
+		}
+		if _, err := r.Read(); !errors.Is(err, io.EOF) {
+			t.Errorf("%q: want %s after the last node, got %v", tt.Doc, io.EOF, err)
+		}
+	}
+}
+
+func TestSiblingIndex(t *testing.T) {
+	const doc = `<r><a><x/><y></y></a><b>text</b><c/></r>`
+	want := []string{"<r:0", "<a:0", "<x:0", "<y:1", "/y:1", "/a:0", "<b:1", "/b:1", "<c:2", "/r:0"}
+	r := New(strings.NewReader(doc), nil)
+	var got []string
+	for {
+		n, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		switch n.Type {
+		case BeginElement:
+			got = append(got, fmt.Sprintf("<%s:%d", n.Name.Name, r.SiblingIndex()))
+		case EndElement:
+			got = append(got, fmt.Sprintf("/%s:%d", n.Name.Name, r.SiblingIndex()))
+		}
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("sibling indices mismatched: want %q, got %q", want, got)
+	}
+}
+
+func TestPeekNodeListeners(t *testing.T) {
+	const doc = `<r xmlns:p="urn:p"><p:a/><b>text</b></r>`
+	for _, post := range []bool{false, true} {
+		r := New(strings.NewReader(doc), nil)
+		r.SetPostOrder(post)
+		events := recordEvents(r)
+
+		want := New(strings.NewReader(doc), nil)
+		want.SetPostOrder(post)
+		expected := recordEvents(want)
+		if err := want.Run(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		for {
+			before := len(*events)
+			p, err := r.PeekNode()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(*events) != before {
+				t.Fatalf("post order %t: listeners fired while peeking %s", post, p.Fqn())
+			}
+			n, err := r.Read()
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if n != p {
+				t.Fatalf("post order %t: peeked node not returned by Read", post)
+			}
+		}
+		if got, want := strings.Join(*events, " "), strings.Join(*expected, " "); got != want {
+			t.Errorf("post order %t: events mismatched: want %q, got %q", post, want, got)
+		}
+	}
+}
+
+func TestExpectRootMismatch(t *testing.T) {
+	r := New(strings.NewReader(`<other/>`), nil)
+	events := recordEvents(r)
+	if _, err := r.ExpectRoot(Name{Name: "root"}); !errors.Is(err, ErrMalformed) {
+		t.Fatalf("want %s, got %v", ErrMalformed, err)
+	}
+	if len(*events) > 0 {
+		t.Errorf("listeners fired for mismatched root: %q", *events)
+	}
+}
+
+func TestRawTagFilteredTargets(t *testing.T) {
+	const doc = `<?drop a="1"?><r><?keep b="2"?><?drop c="3"?></r>`
+	r := New(strings.NewReader(doc), nil)
+	r.SetPITargets("keep")
+	var tags []string
+	r.OnRawTag(func(str string) error {
+		tags = append(tags, str)
+		return nil
+	})
+	if err := r.Run(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := []string{"<r>", `<?keep b="2"?>`, "</r>"}
+	if strings.Join(tags, " ") != strings.Join(want, " ") {
+		t.Errorf("raw tags mismatched: want %q, got %q", want, tags)
+	}
+}
+
+func TestExpansionRatioAttrs(t *testing.T) {
+	const content = "a &lt;&#x41;&amp; b"
+	r := New(strings.NewReader(`<r v="`+content+`">`+content+`</r>`), nil)
+	nodes, err := readAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(nodes) < 2 || nodes[0].Type != BeginElement || nodes[1].Type != Text {
+		t.Fatalf("unexpected nodes: %v", nodes)
+	}
+	elem, text := nodes[0].ExpansionRatio(), nodes[1].ExpansionRatio()
+	if elem == 1 {
+		t.Errorf("entities in attribute values not counted")
+	}
+	if elem != text {
+		t.Errorf("ratio mismatched: attribute %f, text %f", elem, text)
+	}
+}
+
+func TestAllowedTypesReset(t *testing.T) {
+	const doc = `<r><!-- c -->text</r>`
+	r := New(strings.NewReader(doc), nil)
+	r.SetAllowedTypes(Comment)
+	r.SetAllowedTypes()
+	nodes, err := readAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(nodes) != 4 {
+		t.Errorf("types still restricted: want 4 nodes, got %d", len(nodes))
+	}
+}
+
+func TestAttributePositions(t *testing.T) {
+	const doc = "<r>\n  <a x=\"1\" yy='2'\n     z=\"3\"/></r>"
+	r := New(strings.NewReader(doc), nil)
+	var got []string
+	r.OnAttributeAt(func(owner, attr Name, value string, line, col int) error {
+		got = append(got, fmt.Sprintf("%s@%s=%s:%d:%d", attr.Fqn(), owner.Fqn(), value, line, col))
+		return nil
+	})
+	if err := r.Run(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := []string{"x@a=1:2:6", "yy@a=2:2:12", "z@a=3:3:6"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("attribute positions mismatched: want %q, got %q", want, got)
+	}
+}
+
+func TestLineEnding(t *testing.T) {
+	tests := []struct {
+		Doc  string
+		Want string
+	}{
+		{Doc: "<r>\r\n<a/>\r\n</r>", Want: "\r\n"},
+		{Doc: "<r>\n<a/>\n</r>", Want: "\n"},
+		{Doc: "<r>\r<a/>\r</r>", Want: "\r"},
+		{Doc: "<r><a/></r>", Want: "\n"},
+	}
+	for _, tt := range tests {
+		r := New(strings.NewReader(tt.Doc), nil)
+		if err := r.Run(); err != nil {
+			t.Fatalf("%q: unexpected error: %s", tt.Doc, err)
+		}
+		if got := r.LineEnding(); got != tt.Want {
+			t.Errorf("%q: line ending mismatched: want %q, got %q", tt.Doc, tt.Want, got)
+		}
+	}
+}
+
+func TestContentParts(t *testing.T) {
+	const doc = `<r v="a&amp;b&#65;c">a&amp;b&#65;c</r>`
+	r := New(strings.NewReader(doc), nil)
+	r.SetExpandEntities(false)
+	nodes, err := readAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(nodes) < 2 || len(nodes[0].Attrs) != 1 {
+		t.Fatalf("unexpected nodes: %v", nodes)
+	}
+	want := []ContentPart{
+		{Type: LiteralPart, Text: "a"},
+		{Type: EntityPart, Text: "&amp;", Name: "amp", Rune: '&'},
+		{Type: LiteralPart, Text: "b"},
+		{Type: CharRefPart, Text: "&#65;", Rune: 'A'},
+		{Type: LiteralPart, Text: "c"},
+	}
+	for name, parts := range map[string][]ContentPart{
+		"text":      nodes[1].Parts(),
+		"attribute": nodes[0].Attrs[0].Parts(),
+	} {
+		if fmt.Sprint(parts) != fmt.Sprint(want) {
+			t.Errorf("%s: parts mismatched: want %v, got %v", name, want, parts)
+		}
+	}
+}
+
+func TestPathFqn(t *testing.T) {
+	const doc = `<root xmlns:p="urn:p"><p:a><b><p:c>text</p:c></b></p:a></root>`
+	r := New(strings.NewReader(doc), nil)
+	n, err := r.Find(func(n *Node) bool {
+		return n.Type == Text
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := []string{"root", "p:a", "b", "p:c"}
+	if got := r.PathFqn(); strings.Join(got, "/") != strings.Join(want, "/") {
+		t.Errorf("path mismatched at %q: want %q, got %q", n.Content, want, got)
+	}
+}
+
+func TestTrimModes(t *testing.T) {
+	const doc = "<p>\n  Pre-Text <i>Inlined</i> Post-text.\n</p>"
+	tests := []struct {
+		Mode TrimMode
+		Want []string
+	}{
+		{Mode: TrimAll, Want: []string{"Pre-Text", "Inlined", "Post-text."}},
+		{Mode: TrimNewlines, Want: []string{"Pre-Text ", "Inlined", " Post-text."}},
+		{Mode: TrimNone, Want: []string{"\n  Pre-Text ", "Inlined", " Post-text.\n"}},
+	}
+	for _, tt := range tests {
+		r := New(strings.NewReader(doc), nil)
+		r.SetTrimMode(tt.Mode)
+		nodes, err := readAll(r)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		var got []string
+		for _, n := range nodes {
+			if n.Type == Text {
+				got = append(got, n.Content)
+			}
+		}
+		if strings.Join(got, "|") != strings.Join(tt.Want, "|") {
+			t.Errorf("mode %d: texts mismatched: want %q, got %q", tt.Mode, tt.Want, got)
+		}
+	}
+}
+
+func TestNameCharacters(t *testing.T) {
+	tests := []struct {
+		Doc  string
+		Want string
+	}{
+		{Doc: `<_private/>`, Want: "_private"},
+		{Doc: `<a.b.c/>`, Want: "a.b.c"},
+	}
+	for _, tt := range tests {
+		nodes, err := readAll(New(strings.NewReader(tt.Doc), nil))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.Doc, err)
+			continue
+		}
+		if len(nodes) == 0 || nodes[0].Fqn() != tt.Want {
+			t.Errorf("%s: want element %s, got %v", tt.Doc, tt.Want, nodes)
+		}
+	}
+	n := readFirst(t, `<r _id="1" data.value="2"/>`, nil)
+	if len(n.Attrs) != 2 || n.Attrs[0].Fqn() != "_id" || n.Attrs[1].Fqn() != "data.value" {
+		t.Errorf("attributes mismatched: %v", n.Attrs)
+	}
+}
+
+type slowReader struct {
+	io.Reader
+	delay time.Duration
+}
+
+func (r slowReader) Read(b []byte) (int, error) {
+	time.Sleep(r.delay)
+	return r.Reader.Read(b)
+}
+
+func TestTimeout(t *testing.T) {
+	doc := "<r>" + strings.Repeat("<item/>", 1000) + "</r>"
+	src := slowReader{
+		Reader: iotest.OneByteReader(strings.NewReader(doc)),
+		delay:  time.Millisecond,
+	}
+	r := New(src, nil)
+	r.SetTimeout(20 * time.Millisecond)
+	if err := r.Run(); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("want %s, got %v", ErrTimeout, err)
+	}
+	if r.Done() {
+		t.Errorf("reader done after timeout")
+	}
+}
+
+func TestSortedAttrs(t *testing.T) {
+	n := readFirst(t, `<r xmlns:b="urn:b" z="1" b:a="2" a="3" b:z="4"/>`, nil)
+	var got []string
+	for _, a := range n.SortedAttrs() {
+		got = append(got, a.Fqn())
+	}
+	want := []string{"a", "b:a", "b:z", "xmlns:b", "z"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("sorted attributes mismatched: want %q, got %q", want, got)
+	}
+	var orig []string
+	for _, a := range n.Attrs {
+		orig = append(orig, a.Fqn())
+	}
+	if want := []string{"xmlns:b", "z", "b:a", "a", "b:z"}; strings.Join(orig, " ") != strings.Join(want, " ") {
+		t.Errorf("original order changed: want %q, got %q", want, orig)
+	}
+}
+
+func TestSkipPreambleLines(t *testing.T) {
+	const doc = "#!/usr/bin/xml\n<root/>"
+	r := New(strings.NewReader(doc), nil)
+	r.SetSkipPreambleLines(1)
+	nodes, err := readAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(nodes) != 1 || nodes[0].Type != BeginElement || nodes[0].Name.Name != "root" {
+		t.Errorf("unexpected nodes after preamble: %v", nodes)
+	}
+}
+
+func TestMisnested(t *testing.T) {
+	r := New(strings.NewReader(`<b><i>text</b></i>`), nil)
+	r.SetMode(ModeLenient)
+	var warnings []string
+	r.OnWarning(func(str string) error {
+		warnings = append(warnings, str)
+		return nil
+	})
+	nodes, err := readAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var got []string
+	for _, n := range nodes {
+		got = append(got, fmt.Sprintf("%s:%s:%s", n.Type, n.Fqn(), n.Content))
+	}
+	want := []string{
+		"begin-element:b:",
+		"begin-element:i:",
+		"text::text",
+		"end-element:i:",
+		"end-element:b:",
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("events mismatched: want %q, got %q", want, got)
+	}
+	wantWarn := []string{
+		"1:14: <i> implicitly closed by </b>",
+		"1:18: stray </i> dropped",
+	}
+	if strings.Join(warnings, "|") != strings.Join(wantWarn, "|") {
+		t.Errorf("warnings mismatched: want %q, got %q", wantWarn, warnings)
+	}
+}
+
+func TestSetKeep(t *testing.T) {
+	const doc = `<r><a/><config><x/><y/></config><b/></r>`
+	r := New(strings.NewReader(doc), func(_ NodeType, n Name) error {
+		if n.Name == "config" {
+			return nil
+		}
+		return ErrSkip
+	})
+	var got []string
+	for {
+		n, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if n.Type == BeginElement && n.Name.Name == "config" {
+			r.SetKeep(nil)
+		}
+		got = append(got, fmt.Sprintf("%s:%s", n.Type, n.Fqn()))
+	}
+	want := []string{
+		"begin-element:config",
+		"begin-element:x",
+		"begin-element:y",
+		"end-element:config",
+		"begin-element:b",
+		"end-element:r",
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("nodes mismatched: want %q, got %q", want, got)
+	}
+}
+
+func TestNextSibling(t *testing.T) {
+	const doc = `<root><items>
+  <item id="1"><name>a</name></item>
+  <!-- comment -->
+  <item id="2"/>
+  text
+  <item id="3"><sub><item id="nested"/></sub></item>
+</items><after/></root>`
+	r := New(strings.NewReader(doc), nil)
+	if _, err := r.Find(func(n *Node) bool { return n.Name.Name == "items" }); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var ids []string
+	for {
+		n, err := r.NextSibling()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		ids = append(ids, n.Attrs[0].Value)
+	}
+	if want := []string{"1", "2", "3"}; strings.Join(ids, " ") != strings.Join(want, " ") {
+		t.Errorf("siblings mismatched: want %q, got %q", want, ids)
+	}
+	n, err := r.Read()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n.Name.Name != "after" {
+		t.Errorf("want after element following items, got %s %s", n.Type, n.Fqn())
+	}
+}
+
+func TestRawTagSample(t *testing.T) {
+	r := New(strings.NewReader(sample), nil)
+	var tags []string
+	r.OnRawTag(func(str string) error {
+		tags = append(tags, str)
+		return nil
+	})
+	if err := r.Run(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(tags) != 16 {
+		t.Errorf("raw tags count mismatched: want 16, got %d (%q)", len(tags), tags)
+	}
+	rest := sample
+	for _, tag := range tags {
+		ix := strings.Index(rest, tag)
+		if ix < 0 {
+			t.Fatalf("raw tag %q not found verbatim in sample", tag)
+		}
+		if strings.ContainsAny(strings.TrimSpace(rest[:ix]), "<>") {
+			t.Errorf("markup skipped before %q: %q", tag, rest[:ix])
+		}
+		rest = rest[ix+len(tag):]
+	}
+}
+
+func TestIgnoreNestedSameName(t *testing.T) {
+	const doc = `<r><a><a/><b>text</b></a><c/></r>`
+	r := New(strings.NewReader(doc), func(t NodeType, n Name) error {
+		if t == BeginElement && n.Name == "a" {
+			return ErrIgnore
+		}
+		return nil
+	})
+	nodes, err := readAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var got []string
+	for _, n := range nodes {
+		got = append(got, fmt.Sprintf("%s:%s", n.Type, n.Fqn()))
+	}
+	want := []string{"begin-element:r", "begin-element:c", "end-element:r"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("nodes mismatched: want %q, got %q", want, got)
+	}
+}
+
+func TestEmptyDocument(t *testing.T) {
+	for _, doc := range []string{"", " \n\t "} {
+		for _, mode := range []Mode{ModeDefault, ModeLenient, ModeStrict} {
+			r := New(strings.NewReader(doc), nil)
+			r.SetMode(mode)
+			_, err := r.Read()
+			want := io.EOF
+			if mode == ModeStrict {
+				want = ErrMalformed
+			}
+			if !errors.Is(err, want) {
+				t.Errorf("%q (mode %d): want %s, got %v", doc, mode, want, err)
+			}
+		}
+	}
+}
+
+func TestMaxNodes(t *testing.T) {
+	const doc = `<r><a/><b>text</b><c/></r>`
+	r := New(strings.NewReader(doc), nil)
+	r.SetMaxNodes(3)
+	var count int
+	for {
+		_, err := r.Read()
+		if errors.Is(err, ErrNodeLimit) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		count++
+	}
+	if count != 3 {
+		t.Errorf("want 3 nodes before the limit, got %d", count)
+	}
+}
+
+func TestCROnlyLines(t *testing.T) {
+	const doc = "<r>\r<a>line1\rline2</a>\r<b/></r>"
+	r := New(strings.NewReader(doc), nil)
+	var (
+		lines []int
+		text  string
+	)
+	for {
+		n, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if n.Type == Text {
+			text = n.Content
+		}
+		if n.Type == BeginElement {
+			lines = append(lines, r.Locator().Line)
+		}
+	}
+	if text != "line1\nline2" {
+		t.Errorf("text not normalized: got %q", text)
+	}
+	if want := []int{1, 2, 4}; fmt.Sprint(lines) != fmt.Sprint(want) {
+		t.Errorf("lines mismatched: want %v, got %v", want, lines)
+	}
+}
+
+func TestSplitEntities(t *testing.T) {
+	r := New(strings.NewReader(`<r>a&amp;b</r>`), nil)
+	r.SetSplitEntities(true)
+	nodes, err := readAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var got []string
+	for _, n := range nodes {
+		got = append(got, fmt.Sprintf("%s:%s:%s", n.Type, n.Fqn(), n.Content))
+	}
+	want := []string{
+		"begin-element:r:",
+		"text::a",
+		"entity:amp:&",
+		"text::b",
+		"end-element:r:",
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("nodes mismatched: want %q, got %q", want, got)
+	}
+}
+
+func TestCurrent(t *testing.T) {
+	const doc = `<?pi x="1"?><r><a>text<!-- in a --></a><b><c/></b></r>`
+	r := New(strings.NewReader(doc), nil)
+	var got []string
+	current := func(kind string) {
+		if n, ok := r.Current(); ok {
+			got = append(got, kind+"@"+n.Fqn())
+		} else {
+			got = append(got, kind+"@-")
+		}
+	}
+	r.OnText(func(string) error {
+		current("text")
+		return nil
+	})
+	r.OnComment(func(string) error {
+		current("comment")
+		return nil
+	})
+	for {
+		n, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		current(n.Type.String())
+	}
+	want := []string{
+		"processing-instruction@-",
+		"begin-element@r",
+		"begin-element@a",
+		"text@a", "text@a",
+		"comment@a", "comment@a",
+		"end-element@r",
+		"begin-element@b",
+		"begin-element@b",
+		"end-element@r",
+		"end-element@-",
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("current elements mismatched:\nwant %q\ngot  %q", want, got)
+	}
+}
+
+func TestLenientLessThan(t *testing.T) {
+	const doc = `<r>a < b</r>`
+	r := New(strings.NewReader(doc), nil)
+	if _, err := readAll(r); err == nil {
+		t.Errorf("strict mode: expected error for '<' followed by space")
+	}
+	r = New(strings.NewReader(doc), nil)
+	r.SetMode(ModeLenient)
+	nodes, err := readAll(r)
+	if err != nil {
+		t.Fatalf("lenient mode: unexpected error: %s", err)
+	}
+	var text string
+	for _, n := range nodes {
+		if n.Type == Text {
+			text += n.Content
+		}
+	}
+	if text != "a < b" {
+		t.Errorf("text mismatched: want %q, got %q", "a < b", text)
+	}
+}
+
+func TestRawHexReference(t *testing.T) {
+	tests := []struct {
+		Input  string
+		Expand bool
+		Want   string
+	}{
+		{Input: `<r>&#xAb;</r>`, Expand: false, Want: "&#xAb;"},
+		{Input: `<r>&#XaB;</r>`, Expand: false, Want: "&#XaB;"},
+		{Input: `<r>&#xAb;</r>`, Expand: true, Want: "«"},
+	}
+	for _, tt := range tests {
+		r := New(strings.NewReader(tt.Input), nil)
+		r.SetExpandEntities(tt.Expand)
+		nodes, err := readAll(r)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.Input, err)
+			continue
+		}
+		if len(nodes) != 3 || nodes[1].Content != tt.Want {
+			t.Errorf("%s (expand: %t): want %q, got %v", tt.Input, tt.Expand, tt.Want, nodes)
+		}
+	}
+}
+
+func TestInvalidCharPolicy(t *testing.T) {
+	const doc = "<r v=\"a\x01b\">a\x01b<![CDATA[a\x01b]]></r>"
+	tests := []struct {
+		Name     string
+		Policy   InvalidCharPolicy
+		Want     string
+		Warnings int
+		Fail     bool
+	}{
+		{Name: "error", Policy: ErrorOnInvalid, Fail: true},
+		{Name: "drop", Policy: DropInvalid, Want: "ab", Warnings: 3},
+		{Name: "replace", Policy: ReplaceInvalid('\uFFFD'), Want: "a\uFFFDb", Warnings: 3},
+	}
+	for _, tt := range tests {
+		var (
+			r        = New(strings.NewReader(doc), nil)
+			warnings int
+		)
+		r.SetInvalidCharPolicy(tt.Policy)
+		r.OnWarning(func(string) error {
+			warnings++
+			return nil
+		})
+		nodes, err := readAll(r)
+		if tt.Fail {
+			if err == nil {
+				t.Errorf("%s: expected error for control character", tt.Name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.Name, err)
+			continue
+		}
+		if len(nodes) != 4 {
+			t.Errorf("%s: unexpected nodes: %v", tt.Name, nodes)
+			continue
+		}
+		got := []string{nodes[0].Attrs[0].Value, nodes[1].Content, nodes[2].Content}
+		for _, str := range got {
+			if str != tt.Want {
+				t.Errorf("%s: content mismatched: want %q, got %q", tt.Name, tt.Want, got)
+				break
+			}
+		}
+		if warnings != tt.Warnings {
+			t.Errorf("%s: want %d warnings, got %d", tt.Name, tt.Warnings, warnings)
+		}
+	}
+}
+
+func TestPreserveCData(t *testing.T) {
+	const doc = "<r><a>  text  </a><b><![CDATA[  data  ]]></b></r>"
+	tests := []struct {
+		Preserve bool
+		Default  bool
+		Want     string
+	}{
+		{Default: true, Want: "  data  "},
+		{Preserve: true, Want: "  data  "},
+		{Preserve: false, Want: "data"},
+	}
+	for _, tt := range tests {
+		r := New(strings.NewReader(doc), nil)
+		if !tt.Default {
+			r.SetPreserveCData(tt.Preserve)
+		}
+		nodes, err := readAll(r)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		for _, n := range nodes {
+			switch {
+			case n.Type == Text && n.Content != "text":
+				t.Errorf("text not trimmed: got %q", n.Content)
+			case n.Type == CData && n.Content != tt.Want:
+				t.Errorf("cdata mismatched (default: %t, preserve: %t): want %q, got %q", tt.Default, tt.Preserve, tt.Want, n.Content)
+			}
+		}
+	}
+}
+
+func TestAttrLessThan(t *testing.T) {
+	const doc = `<r x="a<b"/>`
+	r := New(strings.NewReader(doc), nil)
+	r.SetMode(ModeStrict)
+	if _, err := readAll(r); !errors.Is(err, ErrMalformed) {
+		t.Errorf("strict mode: expected ErrMalformed, got %v", err)
+	}
+	r = New(strings.NewReader(doc), nil)
+	r.SetMode(ModeLenient)
+	nodes, err := readAll(r)
+	if err != nil {
+		t.Fatalf("lenient mode: unexpected error: %s", err)
+	}
+	if len(nodes) != 1 || len(nodes[0].Attrs) != 1 || nodes[0].Attrs[0].Value != "a<b" {
+		t.Errorf("lenient mode: unexpected nodes: %v", nodes)
+	}
+}
+
+func TestLexicalEvents(t *testing.T) {
+	const doc = `<!DOCTYPE r><r>a<![CDATA[b]]></r>`
+	var (
+		r      = New(strings.NewReader(doc), nil)
+		events []string
+	)
+	r.OnDTDStart(func(str string) error {
+		events = append(events, "dtd-start:"+str)
+		return nil
+	})
+	r.OnDTDEnd(func() error {
+		events = append(events, "dtd-end")
+		return nil
+	})
+	r.OnCDataStart(func() error {
+		events = append(events, "cdata-start")
+		return nil
+	})
+	r.OnCDataEnd(func() error {
+		events = append(events, "cdata-end")
+		return nil
+	})
+	r.OnText(func(str string) error {
+		events = append(events, "text:"+str)
+		return nil
+	})
+	if err := r.Run(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := []string{"dtd-start:r", "dtd-end", "text:a", "cdata-start", "text:b", "cdata-end"}
+	if strings.Join(events, " ") != strings.Join(want, " ") {
+		t.Errorf("lexical events mismatched: want %q, got %q", want, events)
+	}
+}
+
+func TestLocator(t *testing.T) {
+	const doc = "<r>\n  <a x=\"1\">text</a>\n  <!-- c -->\n</r>"
+	var (
+		r   = New(strings.NewReader(doc), nil, WithSystemID("file.xml"))
+		got []string
+	)
+	locate := func(kind string) {
+		loc := r.Locator()
+		got = append(got, fmt.Sprintf("%s@%s:%s", kind, loc.SystemID, loc.Position))
+	}
+	r.OnBeginElement(func(n Name) error {
+		locate("<" + n.Name)
+		return nil
+	})
+	r.OnEndElement(func(n Name) error {
+		locate("/" + n.Name)
+		return nil
+	})
+	r.OnText(func(string) error {
+		locate("text")
+		return nil
+	})
+	r.OnComment(func(string) error {
+		locate("comment")
+		return nil
+	})
+	if err := r.Run(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := []string{
+		"<r@file.xml:1:1",
+		"<a@file.xml:2:3",
+		"text@file.xml:2:12",
+		"/a@file.xml:2:16",
+		"comment@file.xml:3:3",
+		"/r@file.xml:4:1",
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("locations mismatched:\nwant %q\ngot  %q", want, got)
+	}
+}
+
+func TestRawComments(t *testing.T) {
+	const doc = "<r><!--  padded  comment  --></r>"
+	for _, raw := range []bool{false, true} {
+		r := New(strings.NewReader(doc), nil)
+		r.SetRawComments(raw)
+		nodes, err := readAll(r)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		want := "padded  comment"
+		if raw {
+			want = "  padded  comment  "
+		}
+		if len(nodes) != 3 || nodes[1].Type != Comment || nodes[1].Content != want {
+			t.Errorf("raw %t: comment mismatched: want %q, got %v", raw, want, nodes)
+		}
+	}
+}
+
+func TestFind(t *testing.T) {
+	const doc = `<r><item id="1"/><group><item id="2" kind="x">a</item></group><item id="3" kind="x"/></r>`
+	r := New(strings.NewReader(doc), nil)
+	find := func(n *Node) bool {
+		if n.Type != BeginElement {
+			return false
+		}
+		for _, a := range n.Attrs {
+			if a.Fqn() == "kind" && a.Value == "x" {
+				return true
+			}
+		}
+		return false
+	}
+	n, err := r.Find(find)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n.Attrs[0].Value != "2" || r.Depth() != 3 {
+		t.Errorf("unexpected node %s (id: %s) at depth %d", n.Fqn(), n.Attrs[0].Value, r.Depth())
+	}
+	if n, err = r.Find(find); err != nil || n.Attrs[0].Value != "3" {
+		t.Errorf("next match mismatched: %v (%v)", n, err)
+	}
+	if _, err = r.Find(find); !errors.Is(err, io.EOF) {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
+
+func TestCollapseAttrWhitespace(t *testing.T) {
+	const doc = "<r x=\"  a   b\t\tc  \"/>"
+	tests := []struct {
+		Collapse bool
+		Want     string
+	}{
+		{Collapse: false, Want: "a   b\t\tc"},
+		{Collapse: true, Want: "a b c"},
+	}
+	for _, tt := range tests {
+		r := New(strings.NewReader(doc), nil)
+		r.SetCollapseAttrWhitespace(tt.Collapse)
+		n, err := r.Read()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got := n.Attrs[0].Value; got != tt.Want {
+			t.Errorf("collapse %t: value mismatched: want %q, got %q", tt.Collapse, tt.Want, got)
+		}
+	}
+}
+
+func TestUnknownDeclaration(t *testing.T) {
+	const doc = `<!NOTATION gif PUBLIC "image/gif" '<x>'><r>text</r>`
+	r := New(strings.NewReader(doc), nil)
+	if _, err := readAll(r); !errors.Is(err, ErrMalformed) {
+		t.Errorf("default mode: expected ErrMalformed, got %v", err)
+	}
+	r = New(strings.NewReader(doc), nil)
+	r.SetMode(ModeLenient)
+	nodes, err := readAll(r)
+	if err != nil {
+		t.Fatalf("lenient mode: unexpected error: %s", err)
+	}
+	var got []string
+	for _, n := range nodes {
+		got = append(got, fmt.Sprintf("%s:%s:%s", n.Type, n.Fqn(), n.Content))
+	}
+	want := []string{
+		`declaration:NOTATION:gif PUBLIC "image/gif" '<x>'`,
+		"begin-element:r:",
+		"text::text",
+		"end-element:r:",
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("nodes mismatched:\nwant %q\ngot  %q", want, got)
+	}
+}
+
+func TestSourceBytes(t *testing.T) {
+	doc := "\xEF\xBB\xBF" + sample
+	r := New(strings.NewReader(doc), nil, WithSource())
+	if err := r.Run(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := string(r.Source()); got != doc {
+		t.Errorf("source mismatched:\nwant %q\ngot  %q", doc, got)
+	}
+	if got := New(strings.NewReader(doc), nil).Source(); len(got) != 0 {
+		t.Errorf("source kept without WithSource: %q", got)
+	}
+}
+
+func TestXMLSpaceScopes(t *testing.T) {
+	const doc = `<r><p xml:space="preserve"><a>  x  </a><b xml:space="default">  y  </b><c>  z  </c></p><d>  w  </d></r>`
+	r := New(strings.NewReader(doc), nil)
+	r.SetXMLSpaceAware(true)
+	nodes, err := readAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var got []string
+	for _, n := range nodes {
+		if n.Type == Text {
+			got = append(got, n.Content)
+		}
+	}
+	want := []string{"  x  ", "y", "  z  ", "w"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("texts mismatched: want %q, got %q", want, got)
+	}
+}
+
+func TestAttrTokens(t *testing.T) {
+	n, err := New(strings.NewReader("<r class=\"  a   b\tc  \" empty=\"  \"/>"), nil).Read()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := []string{"a", "b", "c"}
+	if got := n.AttrTokens("class"); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("tokens mismatched: want %q, got %q", want, got)
+	}
+	if got := n.AttrTokens("empty"); len(got) != 0 {
+		t.Errorf("unexpected tokens for blank value: %q", got)
+	}
+	if got := n.AttrTokens("missing"); got != nil {
+		t.Errorf("unexpected tokens for missing attribute: %q", got)
+	}
+}
+
+func TestTextBrackets(t *testing.T) {
+	const doc = `<r>a&amp;b<![CDATA[c]]>d<x/>e</r>`
+	r := New(strings.NewReader(doc), nil)
+	r.SetSplitEntities(true)
+	events := recordEvents(r)
+	r.OnTextStart(func() error {
+		*events = append(*events, "[")
+		return nil
+	})
+	r.OnTextEnd(func() error {
+		*events = append(*events, "]")
+		return nil
+	})
+	r.OnText(func(str string) error {
+		*events = append(*events, str)
+		return nil
+	})
+	if err := r.Run(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := "<r [ a & b c d ] <x [ e ] /r"
+	if got := strings.Join(*events, " "); got != want {
+		t.Errorf("events mismatched: want %q, got %q", want, got)
+	}
+}
+
+func TestTracer(t *testing.T) {
+	const doc = `<r><a>x&amp;y</a></r>`
+	var (
+		r   = New(strings.NewReader(doc), nil)
+		got []string
+	)
+	r.SetTracer(func(event string, args ...interface{}) {
+		got = append(got, strings.TrimSpace(fmt.Sprintln(append([]interface{}{event}, args...)...)))
+	})
+	if err := r.Run(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := []string{
+		"dispatch r",
+		"push r",
+		"dispatch a",
+		"push a",
+		"text",
+		"entity &amp;",
+		"dispatch /",
+		"pop a a",
+		"dispatch /",
+		"pop r r",
+	}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("trace mismatched:\nwant %q\ngot  %q", want, got)
+	}
+}
+
+func TestRejectMixedContent(t *testing.T) {
+	tests := []struct {
+		Input string
+		Fail  bool
+	}{
+		{Input: `<a>text<b/></a>`, Fail: true},
+		{Input: `<a><b/>text</a>`, Fail: true},
+		{Input: `<a><b/></a>`},
+		{Input: `<a>text</a>`},
+		{Input: "<a>\n  <b>text</b>\n</a>"},
+	}
+	for _, tt := range tests {
+		r := New(strings.NewReader(tt.Input), nil)
+		r.SetRejectMixedContent(true)
+		_, err := readAll(r)
+		if tt.Fail && !errors.Is(err, ErrMalformed) {
+			t.Errorf("%s: expected ErrMalformed, got %v", tt.Input, err)
+		}
+		if !tt.Fail && err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.Input, err)
+		}
+	}
+}
+
+func TestLenientAttrValues(t *testing.T) {
+	tests := []struct {
+		Value string
+		Want  string
+	}{
+		{Value: `a]]>b`, Want: `a]]>b`},
+		{Value: `&#104;&#x69;&#X21;`, Want: `hi!`},
+		{Value: `?a=1&b=2`, Want: `?a=1&b=2`},
+		{Value: `&unknown;`, Want: `&unknown;`},
+		{Value: `&#xZZ;&amp;`, Want: `&#xZZ;&`},
+		{Value: `trailing &`, Want: `trailing &`},
+	}
+	for _, tt := range tests {
+		r := New(strings.NewReader(`<r v="`+tt.Value+`"/>`), nil)
+		r.SetMode(ModeLenient)
+		n, err := r.Read()
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.Value, err)
+			continue
+		}
+		if got := n.Attrs[0].Value; got != tt.Want {
+			t.Errorf("%s: value mismatched: want %q, got %q", tt.Value, tt.Want, got)
+		}
+	}
+}
+
+func TestLeadingText(t *testing.T) {
+	const doc = `hello <b>world</b>`
+	tests := []struct {
+		Skip bool
+		Want []string
+	}{
+		{Skip: false, Want: []string{"text::hello", "begin-element:b:", "text::world", "end-element:b:"}},
+		{Skip: true, Want: []string{"begin-element:b:", "text::world", "end-element:b:"}},
+	}
+	for _, tt := range tests {
+		r := New(strings.NewReader(doc), nil)
+		r.SetSkipLeadingText(tt.Skip)
+		nodes, err := readAll(r)
+		if err != nil {
+			t.Fatalf("skip %t: unexpected error: %s", tt.Skip, err)
+		}
+		var got []string
+		for _, n := range nodes {
+			got = append(got, fmt.Sprintf("%s:%s:%s", n.Type, n.Fqn(), n.Content))
+		}
+		if strings.Join(got, " ") != strings.Join(tt.Want, " ") {
+			t.Errorf("skip %t: nodes mismatched: want %q, got %q", tt.Skip, tt.Want, got)
+		}
+	}
+}
+
+func TestEqualLocal(t *testing.T) {
+	var (
+		a = Name{NS: "a", Name: "foo"}
+		b = Name{NS: "b", Name: "foo"}
+		c = Name{NS: "a", Name: "bar"}
+	)
+	if !a.EqualLocal(b) || a.Equal(b) {
+		t.Errorf("%s and %s: want EqualLocal but not Equal", a, b)
+	}
+	if a.EqualLocal(c) {
+		t.Errorf("%s and %s: unexpected EqualLocal", a, c)
+	}
+}
+
+func TestListenerErrorPolicy(t *testing.T) {
+	const doc = `<r><a/><b/></r>`
+	errFlaky := errors.New("flaky")
+	for _, policy := range []ListenerErrorPolicy{AbortOnError, ContinueOnError} {
+		var (
+			r     = New(strings.NewReader(doc), nil)
+			names []string
+		)
+		r.SetListenerErrorPolicy(policy)
+		r.OnBeginElement(func(n Name) error {
+			if n.Name == "a" {
+				return errFlaky
+			}
+			return nil
+		})
+		r.OnBeginElement(func(n Name) error {
+			names = append(names, n.Name)
+			return nil
+		})
+		err := r.Run()
+		if policy == AbortOnError {
+			if !errors.Is(err, errFlaky) {
+				t.Errorf("abort: expected listener error, got %v", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("continue: unexpected error: %s", err)
+		}
+		if got := strings.Join(names, " "); got != "r a b" {
+			t.Errorf("continue: other listener not called: got %q", got)
+		}
+		if errs := r.ListenerErrors(); len(errs) != 1 || !errors.Is(errs[0], errFlaky) {
+			t.Errorf("continue: listener errors mismatched: %v", errs)
+		}
+	}
+}
+
+func TestParseName(t *testing.T) {
+	tests := []struct {
+		Input string
+		Want  Name
+		Fail  bool
+	}{
+		{Input: "sax:foo", Want: Name{NS: "sax", Name: "foo"}},
+		{Input: "foo", Want: Name{Name: "foo"}},
+		{Input: "a:b:c", Fail: true},
+		{Input: ":foo", Fail: true},
+		{Input: "foo:", Fail: true},
+		{Input: "", Fail: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseName(tt.Input)
+		if tt.Fail {
+			if !errors.Is(err, ErrMalformed) {
+				t.Errorf("%q: expected ErrMalformed, got %v (%s)", tt.Input, err, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", tt.Input, err)
+			continue
+		}
+		if !got.Equal(tt.Want) {
+			t.Errorf("%q: name mismatched: want %+v, got %+v", tt.Input, tt.Want, got)
+		}
+	}
+}
+
+func TestRejectUnterminated(t *testing.T) {
+	tests := []struct {
+		Input string
+		Want  string
+	}{
+		{Input: `<r><![CDATA[x`, Want: "unterminated CDATA"},
+		{Input: `<r><!--x`, Want: "unterminated comment"},
+		{Input: `<r><?x`, Want: "unterminated processing instruction"},
+	}
+	for _, tt := range tests {
+		r := New(strings.NewReader(tt.Input), nil)
+		r.SetRejectUnterminated(true)
+		_, err := readAll(r)
+		if !errors.Is(err, ErrMalformed) || !strings.Contains(err.Error(), "1:4: "+tt.Want) {
+			t.Errorf("%s: want %q error, got %v", tt.Input, tt.Want, err)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package sax
+
+import (
+	"fmt"
+	"regexp"
+)
+
+func (r *Reader) SetSchema(allowed map[string][]string) {
+	r.schema = allowed
+}
+
+func (r *Reader) SetNamePattern(re *regexp.Regexp) {
+	r.pattern = re
+}
+
+func (r *Reader) checkPattern(n Name) error {
+	if r.pattern == nil || r.pattern.MatchString(n.Fqn()) {
+		return nil
+	}
+	return fmt.Errorf("%w: element %s does not match %s", ErrMalformed, n, r.pattern)
+}
+
+func (r *Reader) allowedElement(n Name) bool {
+	if r.schema == nil {
+		return true
+	}
+	_, ok := r.schema[n.Fqn()]
+	return ok
+}
+
+func (r *Reader) checkSchema(n *Node) error {
+	if r.schema == nil {
+		return nil
+	}
+	if !r.allowedElement(n.Name) {
+		if r.mode != ModeLenient {
+			return fmt.Errorf("%w: element %s not allowed", ErrMalformed, n.Name)
+		}
+		return r.emitWarning(fmt.Sprintf("<%s> not allowed, dropped", n.Name))
+	}
+	var (
+		allowed = r.schema[n.Name.Fqn()]
+		attrs   = n.Attrs[:0]
+	)
+	for _, a := range n.Attrs {
+		if isNamespaceDecl(a.Name) || allowedAttr(allowed, a.Name) {
+			attrs = append(attrs, a)
+			continue
+		}
+		if r.mode != ModeLenient {
+			return fmt.Errorf("%w: attribute %s not allowed on %s", ErrMalformed, a.Name, n.Name)
+		}
+		if err := r.emitWarning(fmt.Sprintf("%s not allowed on <%s>, dropped", a.Name, n.Name)); err != nil {
+			return err
+		}
+	}
+	n.Attrs = attrs
+	return nil
+}
+
+func allowedAttr(allowed []string, n Name) bool {
+	for _, a := range allowed {
+		if a == n.Fqn() {
+			return true
+		}
+	}
+	return false
+}
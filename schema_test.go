@@ -0,0 +1,31 @@
+package sax
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestNamePattern(t *testing.T) {
+	re := regexp.MustCompile(`^[a-z]+(-[a-z]+)*$`)
+	tests := []struct {
+		Input string
+		Fail  bool
+	}{
+		{Input: `<root><first-item a="1"/><second>text</second></root>`},
+		{Input: `<root><firstItem/></root>`, Fail: true},
+		{Input: `<Root/>`, Fail: true},
+	}
+	for _, tt := range tests {
+		r := New(strings.NewReader(tt.Input), nil)
+		r.SetNamePattern(re)
+		_, err := readAll(r)
+		if tt.Fail && !errors.Is(err, ErrMalformed) {
+			t.Errorf("%s: expected ErrMalformed, got %v", tt.Input, err)
+		}
+		if !tt.Fail && err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.Input, err)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package sax
+
+import (
+	"io"
+)
+
+type Dialect int
+
+const (
+	Unknown Dialect = iota
+	SVG
+	XHTML
+	Atom
+	RSS
+	SOAP
+)
+
+func (d Dialect) String() string {
+	switch d {
+	case SVG:
+		return "svg"
+	case XHTML:
+		return "xhtml"
+	case Atom:
+		return "atom"
+	case RSS:
+		return "rss"
+	case SOAP:
+		return "soap"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	svgURI    = "http://www.w3.org/2000/svg"
+	xhtmlURI  = "http://www.w3.org/1999/xhtml"
+	atomURI   = "http://www.w3.org/2005/Atom"
+	rssURI    = "http://purl.org/rss/1.0/"
+	soap11URI = "http://schemas.xmlsoap.org/soap/envelope/"
+	soap12URI = "http://www.w3.org/2003/05/soap-envelope"
+)
+
+func Sniff(rs io.Reader) (Dialect, error) {
+	r := New(rs, nil)
+	if _, err := r.ReadProlog(); err != nil {
+		return Unknown, err
+	}
+	n, err := r.Read()
+	if err != nil {
+		return Unknown, err
+	}
+	if n.Type != BeginElement {
+		return Unknown, nil
+	}
+	var (
+		uri = rootURI(n, n.NS)
+		def = rootURI(n, "")
+	)
+	switch n.Name.Name {
+	case "svg":
+		if uri == "" || uri == svgURI {
+			return SVG, nil
+		}
+	case "html":
+		if uri == xhtmlURI {
+			return XHTML, nil
+		}
+	case "feed", "entry":
+		if uri == atomURI {
+			return Atom, nil
+		}
+	case "rss":
+		if uri == "" {
+			return RSS, nil
+		}
+	case "RDF":
+		if def == rssURI {
+			return RSS, nil
+		}
+	case "Envelope":
+		if uri == soap11URI || uri == soap12URI {
+			return SOAP, nil
+		}
+	}
+	return Unknown, nil
+}
+
+func rootURI(n *Node, prefix string) string {
+	for _, a := range n.Attrs {
+		if isNamespaceDecl(a.Name) && namespacePrefix(a.Name) == prefix {
+			return a.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,40 @@
+package sax
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSniff(t *testing.T) {
+	tests := []struct {
+		Input string
+		Want  Dialect
+	}{
+		{
+			Input: `<?xml version="1.0" encoding="utf-8"?><feed xmlns="http://www.w3.org/2005/Atom"><title>t</title></feed>`,
+			Want:  Atom,
+		},
+		{
+			Input: `<!-- drawing --><svg xmlns="http://www.w3.org/2000/svg" width="10"><rect/></svg>`,
+			Want:  SVG,
+		},
+		{
+			Input: `<s:svg xmlns:s="http://www.w3.org/2000/svg"/>`,
+			Want:  SVG,
+		},
+		{
+			Input: `<root xmlns="urn:other"><item/></root>`,
+			Want:  Unknown,
+		},
+	}
+	for _, tt := range tests {
+		got, err := Sniff(strings.NewReader(tt.Input))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.Input, err)
+			continue
+		}
+		if got != tt.Want {
+			t.Errorf("%s: dialect mismatched: want %s, got %s", tt.Input, tt.Want, got)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package sax
+
+import (
+	"bufio"
+	"io"
+	"unicode/utf8"
+)
+
+type runeSource interface {
+	io.Reader
+	io.RuneScanner
+	Peek(int) ([]byte, error)
+	Discard(int) (int, error)
+}
+
+func newSource(rs io.Reader, size int) runeSource {
+	if src, ok := rs.(runeSource); ok {
+		return src
+	}
+	if size > 0 {
+		return bufio.NewReaderSize(rs, size)
+	}
+	return bufio.NewReader(rs)
+}
+
+type replaySource struct {
+	runeSource
+	pending []byte
+	off     int
+	size    int
+}
+
+func replay(rs runeSource, marked []byte) runeSource {
+	pending := append([]byte{}, marked...)
+	if src, ok := rs.(*replaySource); ok {
+		src.pending = append(pending, src.pending[src.off:]...)
+		src.off, src.size = 0, -1
+		return src
+	}
+	return &replaySource{
+		runeSource: rs,
+		pending:    pending,
+		size:       -1,
+	}
+}
+
+func (s *replaySource) Read(b []byte) (int, error) {
+	if s.off >= len(s.pending) {
+		s.size = -1
+		return s.runeSource.Read(b)
+	}
+	n := copy(b, s.pending[s.off:])
+	s.off += n
+	s.size = -1
+	return n, nil
+}
+
+func (s *replaySource) ReadRune() (rune, int, error) {
+	if s.off >= len(s.pending) {
+		s.size = 0
+		return s.runeSource.ReadRune()
+	}
+	c, z := utf8.DecodeRune(s.pending[s.off:])
+	s.off += z
+	s.size = z
+	return c, z, nil
+}
+
+func (s *replaySource) UnreadRune() error {
+	switch {
+	case s.size > 0:
+		s.off -= s.size
+		s.size = -1
+		return nil
+	case s.size < 0:
+		return bufio.ErrInvalidUnreadRune
+	default:
+		return s.runeSource.UnreadRune()
+	}
+}
+
+func (s *replaySource) Peek(n int) ([]byte, error) {
+	rest := s.pending[s.off:]
+	if n <= len(rest) {
+		return rest[:n], nil
+	}
+	more, err := s.runeSource.Peek(n - len(rest))
+	return append(append([]byte{}, rest...), more...), err
+}
+
+func (s *replaySource) Discard(n int) (int, error) {
+	s.size = -1
+	z := len(s.pending) - s.off
+	if n <= z {
+		s.off += n
+		return n, nil
+	}
+	s.off = len(s.pending)
+	d, err := s.runeSource.Discard(n - z)
+	return z + d, err
+}
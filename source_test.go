@@ -0,0 +1,150 @@
+package sax
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+type faultSource struct {
+	*bufio.Reader
+	limit  int
+	runes  int
+	failed bool
+}
+
+func (s *faultSource) ReadRune() (rune, int, error) {
+	if s.failed = s.runes >= s.limit; s.failed {
+		return 0, 0, io.ErrUnexpectedEOF
+	}
+	c, z, err := s.Reader.ReadRune()
+	if err == nil {
+		s.runes++
+	}
+	return c, z, err
+}
+
+func (s *faultSource) UnreadRune() error {
+	if s.failed {
+		return bufio.ErrInvalidUnreadRune
+	}
+	err := s.Reader.UnreadRune()
+	if err == nil {
+		s.runes--
+	}
+	return err
+}
+
+func TestSourceFault(t *testing.T) {
+	const doc = `<?xml version="1.0"?>
+<!DOCTYPE root>
+<!-- comment -->
+<root xmlns:p="urn:p" a="1 &amp; 2">
+  <p:item b='x'>text &#x41; &lt;</p:item>
+  <![CDATA[data]]>
+  <?pi c="d"?>
+  <empty/>
+</root>`
+	total := len([]rune(doc))
+	for i := 0; i < total; i++ {
+		src := &faultSource{
+			Reader: bufio.NewReader(strings.NewReader(doc)),
+			limit:  i,
+		}
+		r := New(src, nil)
+		err := r.Run()
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("fault after %d runes (%q): want %s, got %v", i, doc[:len(string([]rune(doc)[:i]))], io.ErrUnexpectedEOF, err)
+		}
+	}
+}
+
+func TestSourceShortReads(t *testing.T) {
+	const doc = `<root a="é&amp;ü"><p:item xmlns:p="urn:p">héllo wörld</p:item><![CDATA[ñ]]><!-- ç --></root>`
+	want, err := readEvents(New(strings.NewReader(doc), nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for name, rs := range map[string]io.Reader{
+		"one-byte": iotest.OneByteReader(strings.NewReader(doc)),
+		"half":     iotest.HalfReader(strings.NewReader(doc)),
+	} {
+		got, err := readEvents(New(rs, nil))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", name, err)
+			continue
+		}
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("%s: events mismatched: want %q, got %q", name, want, got)
+		}
+	}
+}
+
+func TestSourceErrorMidRune(t *testing.T) {
+	const doc = `<root>wö`
+	for i := 1; i < len("ö"); i++ {
+		src := io.MultiReader(
+			strings.NewReader(doc[:len(doc)-len("ö")+i]),
+			iotest.ErrReader(io.ErrUnexpectedEOF),
+		)
+		err := New(src, nil).Run()
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("split after %d bytes: want %s, got %v", i, io.ErrUnexpectedEOF, err)
+		}
+	}
+}
+
+func TestMultiSplit(t *testing.T) {
+	want, err := readEvents(New(strings.NewReader(sample), nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for i := 0; i <= len(sample); i++ {
+		r := NewMulti(nil, strings.NewReader(sample[:i]), strings.NewReader(sample[i:]))
+		got, err := readEvents(r)
+		if err != nil {
+			t.Errorf("split at %d: unexpected error: %s", i, err)
+			continue
+		}
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("split at %d: events mismatched: want %q, got %q", i, want, got)
+		}
+	}
+}
+
+func readEvents(r *Reader) ([]string, error) {
+	nodes, err := readAll(r)
+	list := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		list = append(list, fmt.Sprintf("%d:%s:%v:%s", n.Type, n.Fqn(), n.Attrs, n.Content))
+	}
+	return list, err
+}
+
+func TestBufferSize(t *testing.T) {
+	long := strings.Repeat("x", 100)
+	docs := []string{
+		sample,
+		`<` + long + ` a="` + long + `">` + long + `<!--` + long + `--><![CDATA[` + long + `]]></` + long + `>`,
+	}
+	for _, doc := range docs {
+		want, err := readEvents(New(strings.NewReader(doc), nil))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		for _, size := range []int{16, 1 << 20} {
+			got, err := readEvents(New(plainReader{strings.NewReader(doc)}, nil, WithBufferSize(size)))
+			if err != nil {
+				t.Errorf("size %d: unexpected error: %s", size, err)
+				continue
+			}
+			if strings.Join(got, "\n") != strings.Join(want, "\n") {
+				t.Errorf("size %d: events mismatched:\nwant %q\ngot  %q", size, want, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package sax
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+type Event struct {
+	Node *Node
+	Err  error
+}
+
+func (r *Reader) Stream(ctx context.Context) <-chan Event {
+	r.ctx = ctx
+	queue := make(chan Event)
+	go func() {
+		defer close(queue)
+		for {
+			var e Event
+			e.Node, e.Err = r.Read()
+			if errors.Is(e.Err, io.EOF) {
+				return
+			}
+			select {
+			case queue <- e:
+			case <-ctx.Done():
+				return
+			}
+			if e.Err != nil {
+				return
+			}
+		}
+	}()
+	return queue
+}
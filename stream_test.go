@@ -0,0 +1,32 @@
+package sax
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestStreamSample(t *testing.T) {
+	want, err := readAll(New(strings.NewReader(sample), nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var (
+		r   = New(strings.NewReader(sample), nil)
+		got []*Node
+	)
+	for e := range r.Stream(context.Background()) {
+		if e.Err != nil {
+			t.Fatalf("unexpected error: %s", e.Err)
+		}
+		got = append(got, e.Node)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("want %d nodes, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i].Type != want[i].Type || got[i].Fqn() != want[i].Fqn() || got[i].Content != want[i].Content {
+			t.Errorf("node %d mismatched: want %s %s, got %s %s", i, want[i].Type, want[i].Fqn(), got[i].Type, got[i].Fqn())
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package sax
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+type TreeOption int
+
+const (
+	TreeComments TreeOption = 1 << iota
+	TreeInstructions
+)
+
+type Element struct {
+	*Node
+	Parent   *Element
+	Children []*Element
+}
+
+func Parse(r io.Reader) (*Element, error) {
+	return ParseWithOptions(r, 0)
+}
+
+func ParseWithOptions(r io.Reader, opts TreeOption) (*Element, error) {
+	var (
+		rs    = New(r, nil)
+		root  *Element
+		stack []*Element
+	)
+	for {
+		n, err := rs.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		var parent *Element
+		if z := len(stack); z > 0 {
+			parent = stack[z-1]
+		}
+		switch n.Type {
+		case BeginElement:
+			e := &Element{
+				Node:   n,
+				Parent: parent,
+			}
+			if parent == nil {
+				root = e
+			} else {
+				parent.Children = append(parent.Children, e)
+			}
+			if !n.SelfClosing {
+				stack = append(stack, e)
+			}
+		case EndElement:
+			stack = stack[:len(stack)-1]
+		case Text, CData:
+			parent.append(n)
+		case Comment:
+			if opts&TreeComments != 0 {
+				parent.append(n)
+			}
+		case ProcInst:
+			if opts&TreeInstructions != 0 {
+				parent.append(n)
+			}
+		}
+	}
+	if root == nil {
+		return nil, fmt.Errorf("%w: no root element", ErrMalformed)
+	}
+	return root, nil
+}
+
+func (e *Element) append(n *Node) {
+	if e == nil {
+		return
+	}
+	c := &Element{
+		Node:   n,
+		Parent: e,
+	}
+	e.Children = append(e.Children, c)
+}
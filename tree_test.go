@@ -0,0 +1,33 @@
+package sax
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseWithOptions(t *testing.T) {
+	const doc = `<r><a/><!-- first --><?pi x="1"?><b>text</b><!-- second --></r>`
+	tests := []struct {
+		Opts TreeOption
+		Want []NodeType
+	}{
+		{Opts: 0, Want: []NodeType{BeginElement, BeginElement}},
+		{Opts: TreeComments, Want: []NodeType{BeginElement, Comment, BeginElement, Comment}},
+		{Opts: TreeComments | TreeInstructions, Want: []NodeType{BeginElement, Comment, ProcInst, BeginElement, Comment}},
+	}
+	for _, tt := range tests {
+		root, err := ParseWithOptions(strings.NewReader(doc), tt.Opts)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(root.Children) != len(tt.Want) {
+			t.Errorf("options %d: want %d children, got %d", tt.Opts, len(tt.Want), len(root.Children))
+			continue
+		}
+		for i, c := range root.Children {
+			if c.Type != tt.Want[i] {
+				t.Errorf("options %d: child %d: want %s, got %s", tt.Opts, i, tt.Want[i], c.Type)
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package sax
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type Writer struct {
+	inner *bufio.Writer
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{
+		inner: bufio.NewWriter(w),
+	}
+}
+
+func (w *Writer) Flush() error {
+	return w.inner.Flush()
+}
+
+func (w *Writer) Write(n *Node) error {
+	w.inner.WriteString(n.LeadingWhitespace)
+	if n.Raw != "" {
+		_, err := w.inner.WriteString(n.Raw)
+		return err
+	}
+	switch n.Type {
+	case BeginElement:
+		return w.writeBegin(n)
+	case EndElement:
+		_, err := fmt.Fprintf(w.inner, "</%s>", n.Name)
+		return err
+	case Text:
+		str := EscapeText(n.Content)
+		if len(n.parts) > 0 {
+			str = escapeParts(n.parts, EscapeText)
+		}
+		_, err := w.inner.WriteString(str)
+		return err
+	case CData:
+		_, err := fmt.Fprintf(w.inner, "<![CDATA[%s]]>", n.Content)
+		return err
+	case Comment:
+		_, err := fmt.Fprintf(w.inner, "<!--%s-->", n.Content)
+		return err
+	case ProcInst:
+		return w.writeInstruction(n)
+	case DocType:
+		_, err := fmt.Fprintf(w.inner, "<!DOCTYPE %s>", n.Content)
+		return err
+	case Declaration:
+		_, err := fmt.Fprintf(w.inner, "<!%s>", strings.TrimSpace(n.Name.Fqn()+" "+n.Content))
+		return err
+	default:
+		return fmt.Errorf("%s: can not write node", n.Type)
+	}
+}
+
+func (w *Writer) writeBegin(n *Node) error {
+	w.inner.WriteRune(langle)
+	w.inner.WriteString(n.Name.Fqn())
+	if err := n.WriteAttrs(w.inner); err != nil {
+		return err
+	}
+	if n.SelfClosing {
+		w.inner.WriteRune(slash)
+	}
+	_, err := w.inner.WriteRune(rangle)
+	return err
+}
+
+func (w *Writer) writeInstruction(n *Node) error {
+	w.inner.WriteRune(langle)
+	w.inner.WriteRune(mark)
+	w.inner.WriteString(n.Name.Fqn())
+	if err := n.WriteAttrs(w.inner); err != nil {
+		return err
+	}
+	w.inner.WriteRune(mark)
+	_, err := w.inner.WriteRune(rangle)
+	return err
+}
+
+func (n *Node) WriteAttrs(w io.Writer) error {
+	escape := func(str string) string {
+		return EscapeAttr(str, dquote)
+	}
+	for _, a := range n.Attrs {
+		str := escape(a.Value)
+		if len(a.parts) > 0 {
+			str = escapeParts(a.parts, escape)
+		}
+		_, err := fmt.Fprintf(w, " %s=\"%s\"", a.Fqn(), str)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func escapeParts(parts []ContentPart, escape func(string) string) string {
+	var str strings.Builder
+	for _, p := range parts {
+		if p.Type == LiteralPart {
+			str.WriteString(escape(p.Text))
+		} else {
+			str.WriteString(p.Text)
+		}
+	}
+	return str.String()
+}
@@ -0,0 +1,72 @@
+package sax
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteAttrs(t *testing.T) {
+	n, err := New(strings.NewReader(`<r z="1" a="x &lt; &quot;y&quot;" m="&amp;"/>`), nil).Read()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var buf bytes.Buffer
+	if err := n.WriteAttrs(&buf); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := ` z="1" a="x &lt; &quot;y&quot;" m="&amp;"`
+	if got := buf.String(); got != want {
+		t.Errorf("attributes mismatched:\nwant %s\ngot  %s", want, got)
+	}
+}
+
+func TestWriteRawRoundTrip(t *testing.T) {
+	const doc = `<r v="a &amp; b&#65; &lt;c&gt;">x &lt; y &amp; z&#x21;<e k="&quot;"/></r>`
+	r := New(strings.NewReader(doc), nil)
+	r.SetExpandEntities(false)
+	nodes, err := readAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var (
+		buf bytes.Buffer
+		ws  = NewWriter(&buf)
+	)
+	for _, n := range nodes {
+		if err := ws.Write(n); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if err := ws.Flush(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := buf.String(); got != doc {
+		t.Errorf("raw round trip mismatched:\nwant %s\ngot  %s", doc, got)
+	}
+}
+
+func TestWriteLayoutSample(t *testing.T) {
+	r := New(strings.NewReader(sample), nil)
+	r.SetPreserveLayout(true)
+	nodes, err := readAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var (
+		buf bytes.Buffer
+		ws  = NewWriter(&buf)
+	)
+	for _, n := range nodes {
+		if err := ws.Write(n); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if err := ws.Flush(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	buf.WriteString(r.TrailingWhitespace())
+	if got := buf.String(); got != sample {
+		t.Errorf("layout round trip mismatched:\nwant %q\ngot  %q", sample, got)
+	}
+}